@@ -20,6 +20,9 @@ var _ Expression = &IfExpression{}
 var _ Expression = &FunctionLiteral{}
 var _ Expression = &MacroLiteral{}
 var _ Expression = &CallExpression{}
+var _ Expression = &RestExpression{}
+var _ Expression = &MatchExpression{}
+var _ Expression = &SliceExpression{}
 
 type Node interface {
 	TokenLiteral() string
@@ -162,7 +165,9 @@ type LetStatement struct {
 	Token token.Token // LET
 	// let name = value
 	// let x = y;
-	Name  *Identifier
+	// let [a, ...rest] = arr;
+	// let {name, age: years} = user;
+	Name  Expression // an identifier, or an array or hash pattern
 	Value Expression
 }
 
@@ -270,8 +275,8 @@ func (i *BlockStatement) TokenLiteral() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token   // "fn"
-	Parameters []*Identifier // (x, y)
+	Token      token.Token  // "fn"
+	Parameters []Expression // (x, y), identifiers or unquote_splice calls in quote
 	Body       *BlockStatement
 }
 
@@ -380,9 +385,45 @@ func (i *IndexExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
 
+// SliceExpression is left[low:high], low or high is nil if omitted, e.g. arr[1:], arr[:-1].
+type SliceExpression struct {
+	Token token.Token // "["
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (s *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(s.Left.String())
+	out.WriteString("[")
+	if s.Low != nil {
+		out.WriteString(s.Low.String())
+	}
+	out.WriteString(":")
+	if s.High != nil {
+		out.WriteString(s.High.String())
+	}
+	out.WriteString("]")
+	out.WriteString(")")
+	return out.String()
+}
+
+func (s *SliceExpression) expressionNode() {}
+func (s *SliceExpression) TokenLiteral() string {
+	return s.Token.Literal
+}
+
 type HashLiteral struct {
 	Token token.Token // '{'
-	Pairs map[Expression]Expression
+	Pairs []HashPair  // in the order they are written
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (hl *HashLiteral) String() string {
@@ -390,8 +431,8 @@ func (hl *HashLiteral) String() string {
 
 	pairs := []string{}
 
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, k.String()+":"+v.String())
+	for _, p := range hl.Pairs {
+		pairs = append(pairs, p.Key.String()+":"+p.Value.String())
 	}
 
 	out.WriteString("{")
@@ -407,8 +448,8 @@ func (hl *HashLiteral) TokenLiteral() string {
 }
 
 type MacroLiteral struct {
-	Token      token.Token   // "macro"
-	Parameters []*Identifier // (x, y)
+	Token      token.Token  // "macro"
+	Parameters []Expression // (x, y), identifiers, unquote_splice calls in quote, and a RestExpression at last
 	Body       *BlockStatement
 }
 
@@ -430,3 +471,59 @@ func (m *MacroLiteral) expressionNode() {}
 func (m *MacroLiteral) TokenLiteral() string {
 	return m.Token.Literal
 }
+
+// RestExpression is ...name, which collects the rest of a list, e.g. the arguments of macro(head, ...body).
+type RestExpression struct {
+	Token token.Token // "..."
+	Name  *Identifier
+}
+
+func (r *RestExpression) String() string {
+	return "..." + r.Name.String()
+}
+
+func (r *RestExpression) expressionNode() {}
+func (r *RestExpression) TokenLiteral() string {
+	return r.Token.Literal
+}
+
+// MatchExpression is match (value) { pattern if guard => body, ... }, the first arm whose pattern matches
+// the value and whose guard is true is evaluated.
+type MatchExpression struct {
+	Token token.Token // "match"
+	Value Expression
+	Arms  []MatchArm
+}
+
+// MatchArm is an arm of a match, the pattern is a literal, an identifier which binds the value (_ for none),
+// or an array or hash of patterns, the last element of an array pattern can be ...rest.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression // nil if there is no guard
+	Body    *BlockStatement
+}
+
+func (m *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, a := range m.Arms {
+		arm := a.Pattern.String()
+		if a.Guard != nil {
+			arm += " if " + a.Guard.String()
+		}
+		arms = append(arms, arm+"=>"+a.Body.String())
+	}
+	out.WriteString("match")
+	out.WriteString("(")
+	out.WriteString(m.Value.String())
+	out.WriteString(")")
+	out.WriteString("{")
+	out.WriteString(strings.Join(arms, ","))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (m *MatchExpression) expressionNode() {}
+func (m *MatchExpression) TokenLiteral() string {
+	return m.Token.Literal
+}
@@ -0,0 +1,119 @@
+package ast
+
+import "fmt"
+
+// Clone returns a deep copy of node, no subtree is shared with the original one.
+// Missing(nil) children stay nil.
+func Clone(node Node) Node {
+	if isNil(node) {
+		return node
+	}
+	switch n := node.(type) {
+	case *Program:
+		return &Program{Statements: cloneStatements(n.Statements)}
+	case *BlockStatement:
+		return cloneBlock(n)
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: n.Token, Expression: cloneExpression(n.Expression)}
+	case *LetStatement:
+		return &LetStatement{Token: n.Token, Name: cloneExpression(n.Name), Value: cloneExpression(n.Value)}
+	case *ReturnStatement:
+		return &ReturnStatement{Token: n.Token, ReturnValue: cloneExpression(n.ReturnValue)}
+
+	case *Identifier:
+		return cloneIdentifier(n)
+	case *IntegerLiteral:
+		c := *n
+		return &c
+	case *StringLiteral:
+		c := *n
+		return &c
+	case *BooleanExpression:
+		c := *n
+		return &c
+	case *NullExpression:
+		c := *n
+		return &c
+	case *PrefixExpression:
+		return &PrefixExpression{Token: n.Token, Op: n.Op, Rhs: cloneExpression(n.Rhs)}
+	case *RestExpression:
+		return &RestExpression{Token: n.Token, Name: cloneIdentifier(n.Name)}
+	case *InfixExpression:
+		return &InfixExpression{Token: n.Token, Lhs: cloneExpression(n.Lhs), Op: n.Op, Rhs: cloneExpression(n.Rhs)}
+	case *IfExpression:
+		return &IfExpression{Token: n.Token, Condition: cloneExpression(n.Condition), If: cloneBlock(n.If), Else: cloneBlock(n.Else)}
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: n.Token, Parameters: cloneExpressions(n.Parameters), Body: cloneBlock(n.Body)}
+	case *MacroLiteral:
+		return &MacroLiteral{Token: n.Token, Parameters: cloneExpressions(n.Parameters), Body: cloneBlock(n.Body)}
+	case *CallExpression:
+		return &CallExpression{Token: n.Token, Arguments: cloneExpressions(n.Arguments), F: cloneExpression(n.F)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: n.Token, Elements: cloneExpressions(n.Elements)}
+	case *IndexExpression:
+		return &IndexExpression{Token: n.Token, Left: cloneExpression(n.Left), Index: cloneExpression(n.Index)}
+	case *SliceExpression:
+		return &SliceExpression{Token: n.Token, Left: cloneExpression(n.Left), Low: cloneExpression(n.Low), High: cloneExpression(n.High)}
+	case *HashLiteral:
+		h := &HashLiteral{Token: n.Token, Pairs: make([]HashPair, 0, len(n.Pairs))}
+		for _, p := range n.Pairs {
+			h.Pairs = append(h.Pairs, HashPair{Key: cloneExpression(p.Key), Value: cloneExpression(p.Value)})
+		}
+		return h
+	case *MatchExpression:
+		m := &MatchExpression{Token: n.Token, Value: cloneExpression(n.Value), Arms: make([]MatchArm, 0, len(n.Arms))}
+		for _, a := range n.Arms {
+			m.Arms = append(m.Arms, MatchArm{Pattern: cloneExpression(a.Pattern), Guard: cloneExpression(a.Guard), Body: cloneBlock(a.Body)})
+		}
+		return m
+	}
+	panic(fmt.Sprintf("ast.Clone: unexpected node type %T", node))
+}
+
+func cloneExpression(e Expression) Expression {
+	if isNil(e) {
+		return e
+	}
+	return Clone(e).(Expression)
+}
+
+func cloneBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	return &BlockStatement{Token: b.Token, Statements: cloneStatements(b.Statements)}
+}
+
+func cloneIdentifier(id *Identifier) *Identifier {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+func cloneStatements(list []Statement) []Statement {
+	if list == nil {
+		return nil
+	}
+	res := make([]Statement, 0, len(list))
+	for _, s := range list {
+		if isNil(s) {
+			res = append(res, s)
+			continue
+		}
+		res = append(res, Clone(s).(Statement))
+	}
+	return res
+}
+
+func cloneExpressions(list []Expression) []Expression {
+	if list == nil {
+		return nil
+	}
+	res := make([]Expression, 0, len(list))
+	for _, e := range list {
+		res = append(res, cloneExpression(e))
+	}
+	return res
+}
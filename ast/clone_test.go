@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+func TestClone(t *testing.T) {
+	for name, tc := range walkSamples() {
+		c := Clone(tc.node)
+		assert.True(t, reflect.DeepEqual(tc.node, c), name)
+		assert.True(t, Equal(tc.node, c), name)
+
+		// no node is shared
+		nodes := map[Node]bool{}
+		Inspect(tc.node, func(n Node) bool {
+			if n != nil {
+				nodes[n] = true
+			}
+			return true
+		})
+		Inspect(c, func(n Node) bool {
+			assert.False(t, n != nil && nodes[n], "%s: %T is shared", name, n)
+			return true
+		})
+	}
+
+	assert.Nil(t, Clone(&IfExpression{Condition: &BooleanExpression{}, If: &BlockStatement{}}).(*IfExpression).Else)
+}
+
+func TestEqual(t *testing.T) {
+	id := func(name string) *Identifier { return &Identifier{Value: name} }
+	num := func(v int) Expression { return &IntegerLiteral{Value: v} }
+
+	// the tokens are ignored
+	assert.True(t, Equal(
+		&Identifier{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+		id("a"),
+	))
+
+	tests := []struct {
+		a, b Node
+	}{
+		{id("a"), id("b")},
+		{id("a"), &StringLiteral{Value: "a"}},
+		{num(1), num(2)},
+		{&InfixExpression{Lhs: num(1), Op: "+", Rhs: num(2)}, &InfixExpression{Lhs: num(1), Op: "-", Rhs: num(2)}},
+		{&InfixExpression{Lhs: num(1), Op: "+", Rhs: num(2)}, &InfixExpression{Lhs: num(2), Op: "+", Rhs: num(1)}},
+		{&CallExpression{F: id("f"), Arguments: []Expression{num(1)}}, &CallExpression{F: id("f")}},
+		{&IfExpression{Condition: id("c"), If: &BlockStatement{}}, &IfExpression{Condition: id("c"), If: &BlockStatement{}, Else: &BlockStatement{}}},
+		{&FunctionLiteral{Parameters: []Expression{id("x")}, Body: &BlockStatement{}}, &MacroLiteral{Parameters: []Expression{id("x")}, Body: &BlockStatement{}}},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: id("a"), Value: num(1)}, {Key: id("b"), Value: num(2)}}},
+			&HashLiteral{Pairs: []HashPair{{Key: id("b"), Value: num(2)}, {Key: id("a"), Value: num(1)}}},
+		},
+		{&LetStatement{Name: id("a"), Value: num(1)}, &ExpressionStatement{Expression: num(1)}},
+	}
+	for i, tc := range tests {
+		assert.False(t, Equal(tc.a, tc.b), "%d: %s == %s", i, tc.a, tc.b)
+		assert.False(t, Equal(tc.b, tc.a), "%d: %s == %s", i, tc.b, tc.a)
+	}
+}
@@ -0,0 +1,155 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// DotTree is a tree to be rendered by DOT, the nodes in Highlight are filled.
+type DotTree struct {
+	Name      string
+	Root      Node
+	Highlight map[Node]bool
+}
+
+// DOT renders the trees as a Graphviz digraph, each tree is a cluster labeled with its name,
+// so that they are drawn side by side, e.g. a program before and after the macro expansion:
+//
+//	monkey ast -dot -expand macro.mk | dot -Tsvg > macro.svg
+//
+// The edges are labeled with the fields of the parent nodes.
+func DOT(trees ...DotTree) string {
+	d := &dot{}
+	d.out.WriteString("digraph ast {\n")
+	d.out.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	for i, t := range trees {
+		fmt.Fprintf(&d.out, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(&d.out, "\t\tlabel=%s;\n", strconv.Quote(t.Name))
+		d.node(t.Root, t.Highlight)
+		d.out.WriteString("\t}\n")
+	}
+	d.out.WriteString("}\n")
+	return d.out.String()
+}
+
+type dot struct {
+	out bytes.Buffer
+	ids int
+}
+
+// node writes node and its subtree, returning the id of node.
+func (d *dot) node(node Node, highlight map[Node]bool) string {
+	id := fmt.Sprintf("n%d", d.ids)
+	d.ids++
+	attrs := ""
+	if highlight[node] {
+		attrs = `, style=filled, fillcolor="lightblue"`
+	}
+	fmt.Fprintf(&d.out, "\t\t%s [label=%s%s];\n", id, strconv.Quote(dotLabel(node)), attrs)
+	for _, c := range dotChildren(node) {
+		if isNil(c.node) {
+			continue
+		}
+		child := d.node(c.node, highlight)
+		fmt.Fprintf(&d.out, "\t\t%s -> %s [label=%s];\n", id, child, strconv.Quote(c.field))
+	}
+	return id
+}
+
+// dotLabel is the kind of the node, followed by its value or operator if any.
+func dotLabel(node Node) string {
+	switch n := node.(type) {
+	case *Identifier:
+		return kind(n) + "\n" + n.Value
+	case *IntegerLiteral:
+		return kind(n) + "\n" + strconv.Itoa(n.Value)
+	case *StringLiteral:
+		return kind(n) + "\n" + strconv.Quote(n.Value)
+	case *BooleanExpression:
+		return kind(n) + "\n" + strconv.FormatBool(n.Value)
+	case *PrefixExpression:
+		return kind(n) + "\n" + n.Op
+	case *InfixExpression:
+		return kind(n) + "\n" + n.Op
+	}
+	return kind(node)
+}
+
+type dotChild struct {
+	field string
+	node  Node
+}
+
+func dotChildren(node Node) []dotChild {
+	var res []dotChild
+	add := func(field string, n Node) {
+		res = append(res, dotChild{field, n})
+	}
+	addList := func(field string, n int, child func(i int) Node) {
+		for i := 0; i < n; i++ {
+			add(fmt.Sprintf("%s[%d]", field, i), child(i))
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		addList("statements", len(n.Statements), func(i int) Node { return n.Statements[i] })
+	case *BlockStatement:
+		addList("statements", len(n.Statements), func(i int) Node { return n.Statements[i] })
+	case *ExpressionStatement:
+		add("expression", n.Expression)
+	case *LetStatement:
+		add("name", n.Name)
+		add("value", n.Value)
+	case *ReturnStatement:
+		add("value", n.ReturnValue)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *BooleanExpression, *NullExpression:
+		// leaves
+	case *PrefixExpression:
+		add("rhs", n.Rhs)
+	case *RestExpression:
+		add("name", n.Name)
+	case *InfixExpression:
+		add("lhs", n.Lhs)
+		add("rhs", n.Rhs)
+	case *IfExpression:
+		add("condition", n.Condition)
+		add("if", n.If)
+		add("else", n.Else)
+	case *FunctionLiteral:
+		addList("parameters", len(n.Parameters), func(i int) Node { return n.Parameters[i] })
+		add("body", n.Body)
+	case *MacroLiteral:
+		addList("parameters", len(n.Parameters), func(i int) Node { return n.Parameters[i] })
+		add("body", n.Body)
+	case *CallExpression:
+		add("function", n.F)
+		addList("arguments", len(n.Arguments), func(i int) Node { return n.Arguments[i] })
+	case *ArrayLiteral:
+		addList("elements", len(n.Elements), func(i int) Node { return n.Elements[i] })
+	case *IndexExpression:
+		add("left", n.Left)
+		add("index", n.Index)
+	case *SliceExpression:
+		add("left", n.Left)
+		add("low", n.Low)
+		add("high", n.High)
+	case *HashLiteral:
+		for i, p := range n.Pairs {
+			add(fmt.Sprintf("pairs[%d].key", i), p.Key)
+			add(fmt.Sprintf("pairs[%d].value", i), p.Value)
+		}
+	case *MatchExpression:
+		add("value", n.Value)
+		for i, a := range n.Arms {
+			add(fmt.Sprintf("arms[%d].pattern", i), a.Pattern)
+			add(fmt.Sprintf("arms[%d].guard", i), a.Guard)
+			add(fmt.Sprintf("arms[%d].body", i), a.Body)
+		}
+	default:
+		panic(fmt.Sprintf("ast.DOT: unexpected node type %T", n))
+	}
+	return res
+}
@@ -0,0 +1,41 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDOT(t *testing.T) {
+	one := &IntegerLiteral{Value: 1}
+	tree := &PrefixExpression{Op: "-", Rhs: one}
+	expected := `digraph ast {
+	node [shape=box, fontname="monospace"];
+	subgraph cluster_0 {
+		label="before";
+		n0 [label="PrefixExpression\n-"];
+		n1 [label="IntegerLiteral\n1", style=filled, fillcolor="lightblue"];
+		n0 -> n1 [label="rhs"];
+	}
+	subgraph cluster_1 {
+		label="after";
+		n2 [label="StringLiteral\n\"s\""];
+	}
+}
+`
+	assert.Equal(t, expected, DOT(
+		DotTree{Name: "before", Root: tree, Highlight: map[Node]bool{one: true}},
+		DotTree{Name: "after", Root: &StringLiteral{Value: "s"}},
+	))
+}
+
+func TestDOTCoversAllNodes(t *testing.T) {
+	for name, tc := range walkSamples() {
+		g := DOT(DotTree{Name: name, Root: tc.node})
+		// every visited node is drawn, and linked to its parent except the root
+		nodes := len(strings.Fields(tc.expected))
+		assert.Equal(t, nodes, strings.Count(g, "[label=")-strings.Count(g, " -> "), name)
+		assert.Equal(t, nodes-1, strings.Count(g, " -> "), name)
+	}
+}
@@ -0,0 +1,121 @@
+package ast
+
+import "fmt"
+
+// Equal reports whether two trees have the same structure and values.
+// Tokens are ignored, so the same code parsed from different places is equal.
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	switch a := a.(type) {
+	case *Program:
+		b, ok := b.(*Program)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && equalStatements(a.Statements, b.Statements)
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && Equal(a.Expression, b.Expression)
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && Equal(a.Name, b.Name) && Equal(a.Value, b.Value)
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && Equal(a.ReturnValue, b.ReturnValue)
+
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && a.Value == b.Value
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && a.Value == b.Value
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && a.Value == b.Value
+	case *BooleanExpression:
+		b, ok := b.(*BooleanExpression)
+		return ok && a.Value == b.Value
+	case *NullExpression:
+		_, ok := b.(*NullExpression)
+		return ok
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && a.Op == b.Op && Equal(a.Rhs, b.Rhs)
+	case *RestExpression:
+		b, ok := b.(*RestExpression)
+		return ok && Equal(a.Name, b.Name)
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && a.Op == b.Op && Equal(a.Lhs, b.Lhs) && Equal(a.Rhs, b.Rhs)
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && Equal(a.Condition, b.Condition) && Equal(a.If, b.If) && Equal(a.Else, b.Else)
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && equalExpressions(a.Parameters, b.Parameters) && Equal(a.Body, b.Body)
+	case *MacroLiteral:
+		b, ok := b.(*MacroLiteral)
+		return ok && equalExpressions(a.Parameters, b.Parameters) && Equal(a.Body, b.Body)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && Equal(a.F, b.F) && equalExpressions(a.Arguments, b.Arguments)
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && equalExpressions(a.Elements, b.Elements)
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Index, b.Index)
+	case *SliceExpression:
+		b, ok := b.(*SliceExpression)
+		return ok && Equal(a.Left, b.Left) && Equal(a.Low, b.Low) && Equal(a.High, b.High)
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for i, p := range a.Pairs {
+			if !Equal(p.Key, b.Pairs[i].Key) || !Equal(p.Value, b.Pairs[i].Value) {
+				return false
+			}
+		}
+		return true
+	case *MatchExpression:
+		b, ok := b.(*MatchExpression)
+		if !ok || len(a.Arms) != len(b.Arms) || !Equal(a.Value, b.Value) {
+			return false
+		}
+		for i, arm := range a.Arms {
+			if !Equal(arm.Pattern, b.Arms[i].Pattern) || !Equal(arm.Guard, b.Arms[i].Guard) || !Equal(arm.Body, b.Arms[i].Body) {
+				return false
+			}
+		}
+		return true
+	}
+	panic(fmt.Sprintf("ast.Equal: unexpected node type %T", a))
+}
+
+func equalStatements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalExpressions(a, b []Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
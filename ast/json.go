@@ -0,0 +1,381 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+// MarshalJSON encodes a tree as JSON, every node is an object with its "kind", its "token"
+// (including the position) and its fields, e.g.
+//
+//	{"kind":"PrefixExpression","op":"-","rhs":{...},"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}}}
+//
+// Missing(nil) children are omitted. UnmarshalJSON decodes it back into the same tree.
+func MarshalJSON(node Node) ([]byte, error) {
+	v, err := encodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// kind returns the type name of a node, i.e. "InfixExpression" for *InfixExpression.
+func kind(node Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+type jsonObject map[string]any
+
+func encodeNode(node Node) (jsonObject, error) {
+	if isNil(node) {
+		return nil, nil
+	}
+	o := jsonObject{"kind": kind(node)}
+	var err error
+	// set encodes a child node into the field, the first error is kept.
+	set := func(field string, child Node) {
+		if err != nil || isNil(child) {
+			return
+		}
+		o[field], err = encodeNode(child)
+	}
+	setList := func(field string, n int, child func(i int) Node) {
+		list := make([]jsonObject, n)
+		for i := range list {
+			if err != nil {
+				return
+			}
+			list[i], err = encodeNode(child(i))
+		}
+		o[field] = list
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		setList("statements", len(n.Statements), func(i int) Node { return n.Statements[i] })
+	case *BlockStatement:
+		o["token"] = n.Token
+		setList("statements", len(n.Statements), func(i int) Node { return n.Statements[i] })
+	case *ExpressionStatement:
+		o["token"] = n.Token
+		set("expression", n.Expression)
+	case *LetStatement:
+		o["token"] = n.Token
+		set("name", n.Name)
+		set("value", n.Value)
+	case *ReturnStatement:
+		o["token"] = n.Token
+		set("value", n.ReturnValue)
+
+	case *Identifier:
+		o["token"] = n.Token
+		o["value"] = n.Value
+	case *IntegerLiteral:
+		o["token"] = n.Token
+		o["value"] = n.Value
+	case *StringLiteral:
+		o["token"] = n.Token
+		o["value"] = n.Value
+	case *BooleanExpression:
+		o["token"] = n.Token
+		o["value"] = n.Value
+	case *NullExpression:
+		o["token"] = n.Token
+	case *PrefixExpression:
+		o["token"] = n.Token
+		o["op"] = n.Op
+		set("rhs", n.Rhs)
+	case *RestExpression:
+		o["token"] = n.Token
+		set("name", n.Name)
+	case *InfixExpression:
+		o["token"] = n.Token
+		o["op"] = n.Op
+		set("lhs", n.Lhs)
+		set("rhs", n.Rhs)
+	case *IfExpression:
+		o["token"] = n.Token
+		set("condition", n.Condition)
+		set("if", n.If)
+		set("else", n.Else)
+	case *FunctionLiteral:
+		o["token"] = n.Token
+		setList("parameters", len(n.Parameters), func(i int) Node { return n.Parameters[i] })
+		set("body", n.Body)
+	case *MacroLiteral:
+		o["token"] = n.Token
+		setList("parameters", len(n.Parameters), func(i int) Node { return n.Parameters[i] })
+		set("body", n.Body)
+	case *CallExpression:
+		o["token"] = n.Token
+		set("function", n.F)
+		setList("arguments", len(n.Arguments), func(i int) Node { return n.Arguments[i] })
+	case *ArrayLiteral:
+		o["token"] = n.Token
+		setList("elements", len(n.Elements), func(i int) Node { return n.Elements[i] })
+	case *IndexExpression:
+		o["token"] = n.Token
+		set("left", n.Left)
+		set("index", n.Index)
+	case *SliceExpression:
+		o["token"] = n.Token
+		set("left", n.Left)
+		set("low", n.Low)
+		set("high", n.High)
+	case *HashLiteral:
+		o["token"] = n.Token
+		pairs := make([]jsonObject, 0, len(n.Pairs))
+		for _, p := range n.Pairs {
+			pair := jsonObject{}
+			if pair["key"], err = encodeNode(p.Key); err != nil {
+				return nil, err
+			}
+			if pair["value"], err = encodeNode(p.Value); err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair)
+		}
+		o["pairs"] = pairs
+	case *MatchExpression:
+		o["token"] = n.Token
+		set("value", n.Value)
+		arms := make([]jsonObject, 0, len(n.Arms))
+		for _, a := range n.Arms {
+			arm := jsonObject{}
+			if arm["pattern"], err = encodeNode(a.Pattern); err != nil {
+				return nil, err
+			}
+			if a.Guard != nil {
+				if arm["guard"], err = encodeNode(a.Guard); err != nil {
+					return nil, err
+				}
+			}
+			if arm["body"], err = encodeNode(a.Body); err != nil {
+				return nil, err
+			}
+			arms = append(arms, arm)
+		}
+		o["arms"] = arms
+	default:
+		return nil, fmt.Errorf("cannot encode node type %T", node)
+	}
+	return o, err
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON.
+func UnmarshalJSON(data []byte) (Node, error) {
+	var raw json.RawMessage = data
+	return decodeNode(raw)
+}
+
+// decoder decodes the fields of a node object on demand, the first error is kept in err.
+type decoder struct {
+	fields map[string]json.RawMessage
+	err    error
+}
+
+func (d *decoder) fail(field string, err error) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s: %v", field, err)
+	}
+}
+
+func (d *decoder) value(field string, v any) {
+	raw, ok := d.fields[field]
+	if !ok || string(raw) == "null" {
+		return
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		d.fail(field, err)
+	}
+}
+
+func (d *decoder) node(field string) Node {
+	raw, ok := d.fields[field]
+	if !ok {
+		return nil
+	}
+	n, err := decodeNode(raw)
+	if err != nil {
+		d.fail(field, err)
+	}
+	return n
+}
+
+func (d *decoder) string(field string) string {
+	var s string
+	d.value(field, &s)
+	return s
+}
+
+func (d *decoder) expression(field string) Expression {
+	return d.asExpression(field, d.node(field))
+}
+
+func (d *decoder) asExpression(field string, n Node) Expression {
+	if n == nil {
+		return nil
+	}
+	e, ok := n.(Expression)
+	if !ok {
+		d.fail(field, fmt.Errorf("should be an expression, but got %s", kind(n)))
+	}
+	return e
+}
+
+func (d *decoder) block(field string) *BlockStatement {
+	n := d.node(field)
+	if n == nil {
+		return nil
+	}
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		d.fail(field, fmt.Errorf("should be a BlockStatement, but got %s", kind(n)))
+	}
+	return b
+}
+
+func (d *decoder) asIdentifier(field string, n Node) *Identifier {
+	if n == nil {
+		return nil
+	}
+	id, ok := n.(*Identifier)
+	if !ok {
+		d.fail(field, fmt.Errorf("should be an Identifier, but got %s", kind(n)))
+	}
+	return id
+}
+
+func (d *decoder) list(field string) []Node {
+	var raws []json.RawMessage
+	d.value(field, &raws)
+	if raws == nil {
+		return nil
+	}
+	res := make([]Node, 0, len(raws))
+	for i, r := range raws {
+		n, err := decodeNode(r)
+		if err != nil {
+			d.fail(fmt.Sprintf("%s[%d]", field, i), err)
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+func (d *decoder) statements(field string) []Statement {
+	nodes := d.list(field)
+	res := make([]Statement, 0, len(nodes))
+	for i, n := range nodes {
+		s, ok := n.(Statement)
+		if !ok {
+			d.fail(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("should be a statement, but got %T", n))
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func (d *decoder) expressions(field string) []Expression {
+	nodes := d.list(field)
+	res := make([]Expression, 0, len(nodes))
+	for i, n := range nodes {
+		res = append(res, d.asExpression(fmt.Sprintf("%s[%d]", field, i), n))
+	}
+	return res
+}
+
+func decodeNode(raw json.RawMessage) (Node, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	d := &decoder{}
+	if err := json.Unmarshal(raw, &d.fields); err != nil {
+		return nil, err
+	}
+	k := d.string("kind")
+	var tok token.Token
+	d.value("token", &tok)
+
+	var node Node
+	switch k {
+	case "Program":
+		node = &Program{Statements: d.statements("statements")}
+	case "BlockStatement":
+		node = &BlockStatement{Token: tok, Statements: d.statements("statements")}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: tok, Expression: d.expression("expression")}
+	case "LetStatement":
+		node = &LetStatement{Token: tok, Name: d.expression("name"), Value: d.expression("value")}
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: tok, ReturnValue: d.expression("value")}
+
+	case "Identifier":
+		node = &Identifier{Token: tok, Value: d.string("value")}
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Token: tok}
+		d.value("value", &n.Value)
+		node = n
+	case "StringLiteral":
+		node = &StringLiteral{Token: tok, Value: d.string("value")}
+	case "BooleanExpression":
+		n := &BooleanExpression{Token: tok}
+		d.value("value", &n.Value)
+		node = n
+	case "NullExpression":
+		node = &NullExpression{Token: tok}
+	case "PrefixExpression":
+		node = &PrefixExpression{Token: tok, Op: d.string("op"), Rhs: d.expression("rhs")}
+	case "RestExpression":
+		node = &RestExpression{Token: tok, Name: d.asIdentifier("name", d.node("name"))}
+	case "InfixExpression":
+		node = &InfixExpression{Token: tok, Lhs: d.expression("lhs"), Op: d.string("op"), Rhs: d.expression("rhs")}
+	case "IfExpression":
+		node = &IfExpression{Token: tok, Condition: d.expression("condition"), If: d.block("if"), Else: d.block("else")}
+	case "FunctionLiteral":
+		node = &FunctionLiteral{Token: tok, Parameters: d.expressions("parameters"), Body: d.block("body")}
+	case "MacroLiteral":
+		node = &MacroLiteral{Token: tok, Parameters: d.expressions("parameters"), Body: d.block("body")}
+	case "CallExpression":
+		node = &CallExpression{Token: tok, F: d.expression("function"), Arguments: d.expressions("arguments")}
+	case "ArrayLiteral":
+		node = &ArrayLiteral{Token: tok, Elements: d.expressions("elements")}
+	case "IndexExpression":
+		node = &IndexExpression{Token: tok, Left: d.expression("left"), Index: d.expression("index")}
+	case "SliceExpression":
+		node = &SliceExpression{Token: tok, Left: d.expression("left"), Low: d.expression("low"), High: d.expression("high")}
+	case "HashLiteral":
+		n := &HashLiteral{Token: tok, Pairs: []HashPair{}}
+		var pairs []map[string]json.RawMessage
+		d.value("pairs", &pairs)
+		for i, p := range pairs {
+			pd := &decoder{fields: p}
+			n.Pairs = append(n.Pairs, HashPair{Key: pd.expression("key"), Value: pd.expression("value")})
+			if pd.err != nil {
+				d.fail(fmt.Sprintf("pairs[%d]", i), pd.err)
+			}
+		}
+		node = n
+	case "MatchExpression":
+		n := &MatchExpression{Token: tok, Value: d.expression("value"), Arms: []MatchArm{}}
+		var arms []map[string]json.RawMessage
+		d.value("arms", &arms)
+		for i, a := range arms {
+			ad := &decoder{fields: a}
+			n.Arms = append(n.Arms, MatchArm{Pattern: ad.expression("pattern"), Guard: ad.expression("guard"), Body: ad.block("body")})
+			if ad.err != nil {
+				d.fail(fmt.Sprintf("arms[%d]", i), ad.err)
+			}
+		}
+		node = n
+	default:
+		return nil, fmt.Errorf("unknown node kind %q", k)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decode %s: %v", k, d.err)
+	}
+	return node, nil
+}
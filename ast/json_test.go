@@ -0,0 +1,89 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for name, tc := range walkSamples() {
+		data, err := MarshalJSON(tc.node)
+		require.Nil(t, err, name)
+		n, err := UnmarshalJSON(data)
+		require.Nil(t, err, name)
+		assert.True(t, reflect.DeepEqual(tc.node, n), "%s: %s", name, data)
+	}
+}
+
+func TestJSONToken(t *testing.T) {
+	node := &PrefixExpression{
+		Token: token.Token{Type: token.MINUS, Literal: "-", Pos: token.Position{Line: 1, Column: 1}},
+		Op:    "-",
+		Rhs:   &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Line: 1, Column: 2}}, Value: 5},
+	}
+	data, err := MarshalJSON(node)
+	require.Nil(t, err)
+	assert.Equal(t, `{"kind":"PrefixExpression","op":"-","rhs":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"5","pos":{"line":1,"column":2}},"value":5},"token":{"type":"-","literal":"-","pos":{"line":1,"column":1}}}`, string(data))
+
+	n, err := UnmarshalJSON(data)
+	require.Nil(t, err)
+	assert.Equal(t, node, n)
+}
+
+func TestJSONError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[]`, "cannot unmarshal"},
+		{`{"kind":"Foo"}`, `unknown node kind "Foo"`},
+		{`{"kind":"PrefixExpression","rhs":{"kind":"BlockStatement"}}`, "decode PrefixExpression: rhs: should be an expression, but got BlockStatement"},
+		{`{"kind":"IfExpression","if":{"kind":"Identifier"}}`, "decode IfExpression: if: should be a BlockStatement, but got Identifier"},
+		{`{"kind":"FunctionLiteral","parameters":[{"kind":"LetStatement"}]}`, "decode FunctionLiteral: parameters[0]: should be an expression, but got LetStatement"},
+		{`{"kind":"Program","statements":[{"kind":"Identifier"}]}`, "decode Program: statements[0]: should be a statement"},
+		{`{"kind":"IntegerLiteral","value":"1"}`, "decode IntegerLiteral: value: json: cannot unmarshal string"},
+	}
+	for _, tc := range tests {
+		_, err := UnmarshalJSON([]byte(tc.input))
+		require.NotNil(t, err, tc.input)
+		assert.Contains(t, err.Error(), tc.expected, tc.input)
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	expected := map[string]string{
+		"Program":             "(program a (return 1))",
+		"Identifier":          "a",
+		"IntegerLiteral":      "1",
+		"NullExpression":      "null",
+		"BooleanExpression":   "true",
+		"StringLiteral":       `"s"`,
+		"InfixExpression":     "(+ a b)",
+		"PrefixExpression":    "(- a)",
+		"RestExpression":      "(... a)",
+		"LetStatement":        "(let a 1)",
+		"ReturnStatement":     "(return 1)",
+		"ExpressionStatement": "1",
+		"BlockStatement":      "(block 1)",
+		"IfExpression":        "(if c (block 1) (block 1))",
+		"FunctionLiteral":     "(fn (x y) (block 1))",
+		"MacroLiteral":        "(macro (x) (block 1))",
+		"CallExpression":      "(call f a 1)",
+		"ArrayLiteral":        "(array a 1)",
+		"IndexExpression":     "(index a 1)",
+		"SliceExpression":     "(slice a nil 1)",
+		"HashLiteral":         "(hash (k1 v1) (k2 1))",
+		"MatchExpression":     "(match v (1 (block 1)) (x (if g) (block 1)))",
+	}
+	samples := walkSamples()
+	require.Equal(t, len(samples), len(expected))
+	for name, tc := range samples {
+		assert.Equal(t, expected[name], SExpr(tc.node), name)
+	}
+	assert.Equal(t, "(if c (block))", SExpr(&IfExpression{Condition: &Identifier{Value: "c"}, If: &BlockStatement{}}))
+}
@@ -1,72 +1,206 @@
 package ast
 
-type Modifer func(Node) Node
+import "fmt"
 
-func Modify(node Node, f Modifer) Node {
+// Modifer is applied to every node by Modify, returning an error aborts the whole modification.
+type Modifer func(Node) (Node, error)
+
+// Modify replaces the nodes in the tree in place, in post-order:
+// the children of a node are modified before the node itself is passed to f.
+// Missing(nil) children are skipped.
+func Modify(node Node, f Modifer) (Node, error) {
 	// log.Printf("modify %v/%T", node, node)
+	var err error
 	switch node := node.(type) {
 	case *Program:
 		for i, s := range node.Statements {
-			node.Statements[i] = Modify(s, f).(Statement)
+			if node.Statements[i], err = modifyStatement(s, f); err != nil {
+				return nil, err
+			}
 		}
-		return node
 
 	case *ExpressionStatement:
-		node.Expression = Modify(node.Expression, f).(Expression)
-		return node
+		if node.Expression, err = modifyExpression(node.Expression, f); err != nil {
+			return nil, err
+		}
 	case *InfixExpression:
-		node.Lhs = Modify(node.Lhs, f).(Expression)
-		node.Rhs = Modify(node.Rhs, f).(Expression)
-		return node
+		if node.Lhs, err = modifyExpression(node.Lhs, f); err != nil {
+			return nil, err
+		}
+		if node.Rhs, err = modifyExpression(node.Rhs, f); err != nil {
+			return nil, err
+		}
 	case *PrefixExpression:
-		node.Rhs = Modify(node.Rhs, f).(Expression)
-		return node
+		if node.Rhs, err = modifyExpression(node.Rhs, f); err != nil {
+			return nil, err
+		}
+	case *RestExpression:
+		if node.Name, err = modifyIdentifier(node.Name, f); err != nil {
+			return nil, err
+		}
 	case *IndexExpression:
-		node.Left = Modify(node.Left, f).(Expression)
-		node.Index = Modify(node.Index, f).(Expression)
-		return node
-	case *BlockStatement:
-		// in if statement, without a else clause, it can be a nil
-		if node == nil {
-			return node
+		if node.Left, err = modifyExpression(node.Left, f); err != nil {
+			return nil, err
+		}
+		if node.Index, err = modifyExpression(node.Index, f); err != nil {
+			return nil, err
+		}
+	case *SliceExpression:
+		if node.Left, err = modifyExpression(node.Left, f); err != nil {
+			return nil, err
 		}
+		if node.Low, err = modifyExpression(node.Low, f); err != nil {
+			return nil, err
+		}
+		if node.High, err = modifyExpression(node.High, f); err != nil {
+			return nil, err
+		}
+	case *BlockStatement:
 		for i, s := range node.Statements {
-			node.Statements[i] = Modify(s, f).(Statement)
+			if node.Statements[i], err = modifyStatement(s, f); err != nil {
+				return nil, err
+			}
 		}
-		return node
 	case *IfExpression:
-		node.Condition = Modify(node.Condition, f).(Expression)
-		node.If = Modify(node.If, f).(*BlockStatement)
-		node.Else = Modify(node.Else, f).(*BlockStatement)
-		return node
+		if node.Condition, err = modifyExpression(node.Condition, f); err != nil {
+			return nil, err
+		}
+		// in if statement, without a else clause, it can be a nil
+		if node.If, err = modifyBlock(node.If, f); err != nil {
+			return nil, err
+		}
+		if node.Else, err = modifyBlock(node.Else, f); err != nil {
+			return nil, err
+		}
 	case *ReturnStatement:
-		node.ReturnValue = Modify(node.ReturnValue, f).(Expression)
-		return node
+		if node.ReturnValue, err = modifyExpression(node.ReturnValue, f); err != nil {
+			return nil, err
+		}
 	case *LetStatement:
-		node.Value = Modify(node.Value, f).(Expression)
-		return node
+		if node.Name, err = modifyExpression(node.Name, f); err != nil {
+			return nil, err
+		}
+		if node.Value, err = modifyExpression(node.Value, f); err != nil {
+			return nil, err
+		}
 	case *FunctionLiteral:
 		for i, p := range node.Parameters {
-			node.Parameters[i] = Modify(p, f).(*Identifier)
+			if node.Parameters[i], err = modifyExpression(p, f); err != nil {
+				return nil, err
+			}
+		}
+		if node.Body, err = modifyBlock(node.Body, f); err != nil {
+			return nil, err
+		}
+	case *MacroLiteral:
+		for i, p := range node.Parameters {
+			if node.Parameters[i], err = modifyExpression(p, f); err != nil {
+				return nil, err
+			}
+		}
+		if node.Body, err = modifyBlock(node.Body, f); err != nil {
+			return nil, err
+		}
+	case *CallExpression:
+		if node.F, err = modifyExpression(node.F, f); err != nil {
+			return nil, err
+		}
+		for i, a := range node.Arguments {
+			if node.Arguments[i], err = modifyExpression(a, f); err != nil {
+				return nil, err
+			}
 		}
-		node.Body = Modify(node.Body, f).(*BlockStatement)
-		return node
 	case *ArrayLiteral:
 		for i, e := range node.Elements {
-			node.Elements[i] = Modify(e, f).(Expression)
+			if node.Elements[i], err = modifyExpression(e, f); err != nil {
+				return nil, err
+			}
 		}
-		return node
-
 	case *HashLiteral:
-		newPairs := make(map[Expression]Expression)
-		for k, v := range node.Pairs {
-			nk := Modify(k, f).(Expression)
-			nv := Modify(v, f).(Expression)
-			newPairs[nk] = nv
-		}
-		node.Pairs = newPairs
-		return node
+		for i, p := range node.Pairs {
+			if node.Pairs[i].Key, err = modifyExpression(p.Key, f); err != nil {
+				return nil, err
+			}
+			if node.Pairs[i].Value, err = modifyExpression(p.Value, f); err != nil {
+				return nil, err
+			}
+		}
+	case *MatchExpression:
+		if node.Value, err = modifyExpression(node.Value, f); err != nil {
+			return nil, err
+		}
+		for i, a := range node.Arms {
+			if node.Arms[i].Pattern, err = modifyExpression(a.Pattern, f); err != nil {
+				return nil, err
+			}
+			if node.Arms[i].Guard, err = modifyExpression(a.Guard, f); err != nil {
+				return nil, err
+			}
+			if node.Arms[i].Body, err = modifyBlock(a.Body, f); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return f(node)
 }
+
+func modifyExpression(e Expression, f Modifer) (Expression, error) {
+	if isNil(e) {
+		return e, nil
+	}
+	n, err := Modify(e, f)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := n.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("cannot replace the expression %s with %T", e.String(), n)
+	}
+	return res, nil
+}
+
+func modifyStatement(s Statement, f Modifer) (Statement, error) {
+	if isNil(s) {
+		return s, nil
+	}
+	n, err := Modify(s, f)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := n.(Statement)
+	if !ok {
+		return nil, fmt.Errorf("cannot replace the statement %s with %T", s.String(), n)
+	}
+	return res, nil
+}
+
+func modifyBlock(b *BlockStatement, f Modifer) (*BlockStatement, error) {
+	if b == nil {
+		return b, nil
+	}
+	n, err := Modify(b, f)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := n.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("cannot replace the block %s with %T", b.String(), n)
+	}
+	return res, nil
+}
+
+func modifyIdentifier(id *Identifier, f Modifer) (*Identifier, error) {
+	if id == nil {
+		return id, nil
+	}
+	n, err := Modify(id, f)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := n.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("cannot replace the identifier %s with %T", id.String(), n)
+	}
+	return res, nil
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -11,13 +12,13 @@ func TestModify(t *testing.T) {
 	one := func() Expression { return &IntegerLiteral{Value: 1} }
 	two := func() Expression { return &IntegerLiteral{Value: 2} }
 
-	turnOneIntoTwo := func(node Node) Node {
-		i := node.(*IntegerLiteral)
-		if i.Value != 1 {
-			return node
+	turnOneIntoTwo := func(node Node) (Node, error) {
+		i, ok := node.(*IntegerLiteral)
+		if !ok || i.Value != 1 {
+			return node, nil
 		}
 		i.Value = 2
-		return i
+		return i, nil
 	}
 
 	tests := []struct {
@@ -152,27 +153,61 @@ func TestModify(t *testing.T) {
 		},
 		{
 			&HashLiteral{
-				Pairs: map[Expression]Expression{one(): one()},
+				Pairs: []HashPair{{Key: one(), Value: one()}, {Key: two(), Value: one()}},
 			},
 			&HashLiteral{
-				Pairs: map[Expression]Expression{two(): two()},
+				Pairs: []HashPair{{Key: two(), Value: two()}, {Key: two(), Value: two()}},
+			},
+		},
+		{
+			&CallExpression{
+				F:         &FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+				Arguments: []Expression{one(), &CallExpression{F: &Identifier{}, Arguments: []Expression{one()}}},
+			},
+			&CallExpression{
+				F:         &FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+				Arguments: []Expression{two(), &CallExpression{F: &Identifier{}, Arguments: []Expression{two()}}},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []Expression{&Identifier{Value: "x"}},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&MacroLiteral{
+				Parameters: []Expression{&Identifier{Value: "x"}},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
 			},
 		},
 	}
 	for i, tc := range tests {
-		modified := Modify(tc.input, turnOneIntoTwo)
-		// assert.Equal(t, modified, tc.expected, "%d: %v", i, tc.input)
-		switch h := modified.(type) {
-		// NOTE: ugly test :(
-		case *HashLiteral:
-			for k, v := range h.Pairs {
-				k := k.(*IntegerLiteral)
-				assert.Equal(t, two(), k)
-				v := v.(*IntegerLiteral)
-				assert.Equal(t, two(), v)
-			}
-		default:
-			assert.True(t, reflect.DeepEqual(modified, tc.expected), "%d: %v", i, tc.input)
+		modified, err := Modify(tc.input, turnOneIntoTwo)
+		assert.Nil(t, err)
+		assert.True(t, reflect.DeepEqual(modified, tc.expected), "%d: %v", i, tc.input)
+	}
+}
+
+func TestModifyError(t *testing.T) {
+	visited := 0
+	failOnTwo := func(node Node) (Node, error) {
+		visited++
+		if i, ok := node.(*IntegerLiteral); ok && i.Value == 2 {
+			return nil, fmt.Errorf("found two")
+		}
+		return node, nil
+	}
+	// [1, 2, 3]: aborted after visiting 1 and 2
+	input := &ArrayLiteral{Elements: []Expression{&IntegerLiteral{Value: 1}, &IntegerLiteral{Value: 2}, &IntegerLiteral{Value: 3}}}
+	_, err := Modify(input, failOnTwo)
+	assert.EqualError(t, err, "found two")
+	assert.Equal(t, 2, visited)
+
+	toStatement := func(node Node) (Node, error) {
+		if _, ok := node.(*IntegerLiteral); ok {
+			return &BlockStatement{}, nil
 		}
+		return node, nil
 	}
+	_, err = Modify(&PrefixExpression{Op: "-", Rhs: &IntegerLiteral{Value: 1}}, toStatement)
+	assert.ErrorContains(t, err, "cannot replace the expression")
 }
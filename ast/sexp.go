@@ -0,0 +1,134 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// SExpr prints a tree as an S-expression, which shows the structure more clearly than String,
+// e.g. "1 + 2 * 3" is printed as
+//
+//	(program (+ 1 (* 2 3)))
+func SExpr(node Node) string {
+	var out bytes.Buffer
+	sexpr(&out, node)
+	return out.String()
+}
+
+func sexpr(out *bytes.Buffer, node Node) {
+	if isNil(node) {
+		out.WriteString("nil")
+		return
+	}
+	// list prints "(head child...)", or "(child...)" without a head.
+	list := func(head string, children ...Node) {
+		out.WriteString("(" + head)
+		for i, c := range children {
+			if i > 0 || head != "" {
+				out.WriteString(" ")
+			}
+			sexpr(out, c)
+		}
+		out.WriteString(")")
+	}
+	switch n := node.(type) {
+	case *Program:
+		list("program", statements(n.Statements)...)
+	case *BlockStatement:
+		list("block", statements(n.Statements)...)
+	case *ExpressionStatement:
+		sexpr(out, n.Expression)
+	case *LetStatement:
+		list("let", n.Name, n.Value)
+	case *ReturnStatement:
+		list("return", n.ReturnValue)
+
+	case *Identifier:
+		out.WriteString(n.Value)
+	case *IntegerLiteral:
+		out.WriteString(strconv.Itoa(n.Value))
+	case *StringLiteral:
+		out.WriteString(strconv.Quote(n.Value))
+	case *BooleanExpression:
+		out.WriteString(strconv.FormatBool(n.Value))
+	case *NullExpression:
+		out.WriteString("null")
+	case *PrefixExpression:
+		list(n.Op, n.Rhs)
+	case *RestExpression:
+		list("...", n.Name)
+	case *InfixExpression:
+		list(n.Op, n.Lhs, n.Rhs)
+	case *IfExpression:
+		if n.Else == nil {
+			list("if", n.Condition, n.If)
+		} else {
+			list("if", n.Condition, n.If, n.Else)
+		}
+	case *FunctionLiteral:
+		out.WriteString("(fn ")
+		list("", expressions(n.Parameters)...)
+		out.WriteString(" ")
+		sexpr(out, n.Body)
+		out.WriteString(")")
+	case *MacroLiteral:
+		out.WriteString("(macro ")
+		list("", expressions(n.Parameters)...)
+		out.WriteString(" ")
+		sexpr(out, n.Body)
+		out.WriteString(")")
+	case *CallExpression:
+		list("call", append([]Node{n.F}, expressions(n.Arguments)...)...)
+	case *ArrayLiteral:
+		list("array", expressions(n.Elements)...)
+	case *IndexExpression:
+		list("index", n.Left, n.Index)
+	case *SliceExpression:
+		list("slice", n.Left, n.Low, n.High)
+	case *HashLiteral:
+		out.WriteString("(hash")
+		for _, p := range n.Pairs {
+			out.WriteString(" ")
+			list("", p.Key, p.Value)
+		}
+		out.WriteString(")")
+	case *MatchExpression:
+		// (match v (pattern body) (pattern (if guard) body))
+		out.WriteString("(match ")
+		sexpr(out, n.Value)
+		for _, a := range n.Arms {
+			out.WriteString(" ")
+			if a.Guard == nil {
+				list("", a.Pattern, a.Body)
+			} else {
+				out.WriteString("(")
+				sexpr(out, a.Pattern)
+				out.WriteString(" ")
+				list("if", a.Guard)
+				out.WriteString(" ")
+				sexpr(out, a.Body)
+				out.WriteString(")")
+			}
+		}
+		out.WriteString(")")
+	default:
+		panic(fmt.Sprintf("ast.SExpr: unexpected node type %T", n))
+	}
+}
+
+func statements(list []Statement) []Node {
+	res := make([]Node, 0, len(list))
+	for _, s := range list {
+		res = append(res, s)
+	}
+	return res
+}
+
+func expressions(list []Expression) []Node {
+	res := make([]Node, 0, len(list))
+	for _, e := range list {
+		res = append(res, e)
+	}
+	return res
+}
@@ -0,0 +1,128 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, the children are visited in source order.
+// Unlike Modify, it never changes the tree. Missing(nil) children are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *ExpressionStatement:
+		walk(v, n.Expression)
+	case *LetStatement:
+		walk(v, n.Name)
+		walk(v, n.Value)
+	case *ReturnStatement:
+		walk(v, n.ReturnValue)
+
+	case *Identifier, *IntegerLiteral, *StringLiteral, *BooleanExpression, *NullExpression:
+		// leaves
+	case *PrefixExpression:
+		walk(v, n.Rhs)
+	case *RestExpression:
+		walk(v, n.Name)
+	case *InfixExpression:
+		walk(v, n.Lhs)
+		walk(v, n.Rhs)
+	case *IfExpression:
+		walk(v, n.Condition)
+		walk(v, n.If)
+		walk(v, n.Else)
+	case *FunctionLiteral:
+		walkExpressions(v, n.Parameters)
+		walk(v, n.Body)
+	case *MacroLiteral:
+		walkExpressions(v, n.Parameters)
+		walk(v, n.Body)
+	case *CallExpression:
+		walk(v, n.F)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walk(v, n.Left)
+		walk(v, n.Index)
+	case *SliceExpression:
+		walk(v, n.Left)
+		walk(v, n.Low)
+		walk(v, n.High)
+	case *HashLiteral:
+		for _, p := range n.Pairs {
+			walk(v, p.Key)
+			walk(v, p.Value)
+		}
+	case *MatchExpression:
+		walk(v, n.Value)
+		for _, a := range n.Arms {
+			walk(v, a.Pattern)
+			walk(v, a.Guard)
+			walk(v, a.Body)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+// walk skips the nil children, a nil pointer in an interface is nil too, e.g. an if without else.
+func walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	Walk(v, node)
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		walk(v, e)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling f(node);
+// node must not be nil. If f returns true, Inspect invokes f recursively for each
+// of the non-nil children of node, followed by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
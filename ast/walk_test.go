@@ -0,0 +1,131 @@
+package ast
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walkSamples has a node of every type, with all the children filled,
+// and the nodes expected to be visited by Walk, in order.
+func walkSamples() map[string]struct {
+	node     Node
+	expected string
+} {
+	id := func(name string) *Identifier { return &Identifier{Value: name} }
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	block := func() *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}
+	}
+	type sample = struct {
+		node     Node
+		expected string
+	}
+	return map[string]sample{
+		"Program":             {&Program{Statements: []Statement{&ExpressionStatement{Expression: id("a")}, &ReturnStatement{ReturnValue: one()}}}, "Program ExpressionStatement a ReturnStatement 1"},
+		"Identifier":          {id("a"), "a"},
+		"IntegerLiteral":      {one(), "1"},
+		"NullExpression":      {&NullExpression{}, "NullExpression"},
+		"BooleanExpression":   {&BooleanExpression{Value: true}, "BooleanExpression"},
+		"StringLiteral":       {&StringLiteral{Value: "s"}, "StringLiteral"},
+		"InfixExpression":     {&InfixExpression{Lhs: id("a"), Op: "+", Rhs: id("b")}, "InfixExpression a b"},
+		"PrefixExpression":    {&PrefixExpression{Op: "-", Rhs: id("a")}, "PrefixExpression a"},
+		"RestExpression":      {&RestExpression{Name: id("a")}, "RestExpression a"},
+		"LetStatement":        {&LetStatement{Name: id("a"), Value: one()}, "LetStatement a 1"},
+		"ReturnStatement":     {&ReturnStatement{ReturnValue: one()}, "ReturnStatement 1"},
+		"ExpressionStatement": {&ExpressionStatement{Expression: one()}, "ExpressionStatement 1"},
+		"BlockStatement":      {block(), "BlockStatement ExpressionStatement 1"},
+		"IfExpression":        {&IfExpression{Condition: id("c"), If: block(), Else: block()}, "IfExpression c BlockStatement ExpressionStatement 1 BlockStatement ExpressionStatement 1"},
+		"FunctionLiteral":     {&FunctionLiteral{Parameters: []Expression{id("x"), id("y")}, Body: block()}, "FunctionLiteral x y BlockStatement ExpressionStatement 1"},
+		"MacroLiteral":        {&MacroLiteral{Parameters: []Expression{id("x")}, Body: block()}, "MacroLiteral x BlockStatement ExpressionStatement 1"},
+		"CallExpression":      {&CallExpression{F: id("f"), Arguments: []Expression{id("a"), one()}}, "CallExpression f a 1"},
+		"ArrayLiteral":        {&ArrayLiteral{Elements: []Expression{id("a"), one()}}, "ArrayLiteral a 1"},
+		"IndexExpression":     {&IndexExpression{Left: id("a"), Index: one()}, "IndexExpression a 1"},
+		"SliceExpression":     {&SliceExpression{Left: id("a"), High: one()}, "SliceExpression a 1"},
+		"MatchExpression":     {&MatchExpression{Value: id("v"), Arms: []MatchArm{{Pattern: one(), Body: block()}, {Pattern: id("x"), Guard: id("g"), Body: block()}}}, "MatchExpression v 1 BlockStatement ExpressionStatement 1 x g BlockStatement ExpressionStatement 1"},
+		"HashLiteral":         {&HashLiteral{Pairs: []HashPair{{Key: id("k1"), Value: id("v1")}, {Key: id("k2"), Value: one()}}}, "HashLiteral k1 v1 k2 1"},
+	}
+}
+
+func visited(node Node) string {
+	var res []string
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case nil:
+		case *Identifier, *IntegerLiteral:
+			res = append(res, n.String())
+		default:
+			res = append(res, strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+		}
+		return true
+	})
+	return strings.Join(res, " ")
+}
+
+func TestWalk(t *testing.T) {
+	for name, tc := range walkSamples() {
+		assert.Equal(t, tc.expected, visited(tc.node), name)
+	}
+}
+
+// TestWalkCoversAllNodes fails if a node type is added to the package without being handled by Walk.
+func TestWalkCoversAllNodes(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	require.Nil(t, err)
+
+	samples := walkSamples()
+	found := 0
+	for _, f := range pkgs["ast"].Files {
+		for _, decl := range f.Decls {
+			name, ok := nodeTypeName(decl)
+			if !ok {
+				continue
+			}
+			found++
+			_, ok = samples[name]
+			assert.True(t, ok, "node type %s is not covered by the walk tests", name)
+		}
+	}
+	assert.Equal(t, len(samples), found, "some node types are gone, update the walk tests")
+}
+
+// nodeTypeName returns X if decl is `func (*X) TokenLiteral() string`.
+func nodeTypeName(decl any) (string, bool) {
+	fd, ok := decl.(*goast.FuncDecl)
+	if !ok || fd.Recv == nil || fd.Name.Name != "TokenLiteral" {
+		return "", false
+	}
+	star, ok := fd.Recv.List[0].Type.(*goast.StarExpr)
+	if !ok {
+		return "", false
+	}
+	return star.X.(*goast.Ident).Name, true
+}
+
+func TestWalkSkipsNil(t *testing.T) {
+	assert.Equal(t, "IfExpression c BlockStatement", visited(&IfExpression{Condition: &Identifier{Value: "c"}, If: &BlockStatement{}}))
+	assert.Equal(t, "LetStatement a", visited(&LetStatement{Name: &Identifier{Value: "a"}}))
+}
+
+func TestInspectPrune(t *testing.T) {
+	node := &CallExpression{
+		F:         &Identifier{Value: "f"},
+		Arguments: []Expression{&FunctionLiteral{Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "inner"}}}}}, &Identifier{Value: "b"}},
+	}
+	var ids []string
+	Inspect(node, func(n Node) bool {
+		if id, ok := n.(*Identifier); ok {
+			ids = append(ids, id.Value)
+		}
+		_, isFn := n.(*FunctionLiteral)
+		return !isFn
+	})
+	assert.Equal(t, []string{"f", "b"}, ids)
+}
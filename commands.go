@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/eval"
+	"github.com/ChaosNyaruko/monkey/format"
+	"github.com/ChaosNyaruko/monkey/lexer"
+	"github.com/ChaosNyaruko/monkey/object"
+	"github.com/ChaosNyaruko/monkey/parser"
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+type command struct {
+	short string
+	run   func(args []string) int // returns the exit status
+}
+
+// commandNames is the order to show the commands in the usage.
+var commandNames = []string{"run", "check", "fmt", "tokens", "ast"}
+
+var commands = map[string]*command{
+	"run": {
+		short: "run a script, the arguments are passed to it as `args`",
+		run:   runCmd,
+	},
+	"check": {
+		short: "parse, expand macros and statically check scripts without running them",
+		run:   checkCmd,
+	},
+	"fmt": {
+		short: "format scripts canonically, -w to rewrite the files instead of printing them",
+		run:   fmtCmd,
+	},
+	"tokens": {
+		short: "dump the tokens of a script",
+		run:   tokensCmd,
+	},
+	"ast": {
+		short: "dump the syntax tree of a script",
+		run:   astCmd,
+	},
+}
+
+// newFlagSet creates the flag set of a command, usage is the arguments after the command name.
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: monkey %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runCmd(args []string) int {
+	fs := newFlagSet("run", "[-io dirs] [-io-write] [-trace-macros] [-max-macro-depth n] file.mk [arguments]")
+	roots := fs.String("io", "", "comma separated directories the script may read, enables the file and stdin builtins")
+	write := fs.Bool("io-write", false, "allow the script to write files under the -io directories")
+	trace := fs.Bool("trace-macros", false, "print every macro expansion step to stderr")
+	depth := fs.Int("max-macro-depth", eval.DefaultMaxDepth, "the maximum nesting depth of the macro expansions")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+	return runFile(fs.Arg(0), fs.Args()[1:], ioPolicy(*roots, *write), expander(*trace, *depth))
+}
+
+func checkCmd(args []string) int {
+	fs := newFlagSet("check", "file.mk...")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+	status := 0
+	for _, filename := range fs.Args() {
+		env := object.NewEnvironment(nil)
+		if err := eval.EnableScript(env, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			return 1
+		}
+		program, err := load(filename, env, &eval.Expander{})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			status = 1
+			continue
+		}
+		for _, err := range eval.Check(program, env) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func fmtCmd(args []string) int {
+	fs := newFlagSet("fmt", "[-w] [-l] file.mk...")
+	write := fs.Bool("w", false, "write the result to the source files instead of stdout")
+	list := fs.Bool("l", false, "list the files whose formatting differs")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+	status := 0
+	for _, filename := range fs.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			status = 1
+			continue
+		}
+		res, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filename, err)
+			status = 1
+			continue
+		}
+		if !*write && !*list {
+			os.Stdout.Write(res)
+			continue
+		}
+		if bytes.Equal(src, res) {
+			continue
+		}
+		if *list {
+			fmt.Println(filename)
+		}
+		if *write {
+			if err := os.WriteFile(filename, res, 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+func tokensCmd(args []string) int {
+	fs := newFlagSet("tokens", "file.mk")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open file err: %v\n", err)
+		return 1
+	}
+	l := lexer.New(string(b))
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Printf("%-8s %q\n", tok.Type, tok.Literal)
+	}
+	return 0
+}
+
+func astCmd(args []string) int {
+	fs := newFlagSet("ast", "[-expand] [-trace-macros] [-format string|json|sexp] [-dot] file.mk")
+	expand := fs.Bool("expand", false, "dump the tree after macro expansion")
+	trace := fs.Bool("trace-macros", false, "print every macro expansion step to stderr, with -expand")
+	format := fs.String("format", "string", "the output format: string(source code), json or sexp(S-expressions)")
+	dot := fs.Bool("dot", false, "dump the tree as a Graphviz graph, with -expand the trees before and after the expansion are drawn side by side")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *dot {
+		graph, err := dotGraph(fs.Arg(0), *expand)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		fmt.Print(graph)
+		return 0
+	}
+	var program *ast.Program
+	var err error
+	if *expand {
+		program, err = load(fs.Arg(0), object.NewEnvironment(nil), expander(*trace, 0))
+	} else {
+		program, err = parse(fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	switch *format {
+	case "string":
+		for _, s := range program.Statements {
+			fmt.Println(s.String())
+		}
+	case "sexp":
+		for _, s := range program.Statements {
+			fmt.Println(ast.SExpr(s))
+		}
+	case "json":
+		data, err := ast.MarshalJSON(program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		var out bytes.Buffer
+		json.Indent(&out, data, "", "  ")
+		fmt.Println(out.String())
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+// dotGraph renders the tree of the script, if expand is set, it is rendered before and after the macro expansion,
+// the expanded macro calls and the nodes they are replaced with are highlighted.
+func dotGraph(filename string, expand bool) (string, error) {
+	program, err := parse(filename)
+	if err != nil {
+		return "", err
+	}
+	if !expand {
+		return ast.DOT(ast.DotTree{Name: filename, Root: program}), nil
+	}
+
+	// the expansion modifies the program in place, the expanded calls are mapped to
+	// the nodes of the copy, which have the same order.
+	before := ast.Clone(program)
+	var nodes, copies []ast.Node
+	ast.Inspect(program, func(n ast.Node) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	ast.Inspect(before, func(n ast.Node) bool {
+		copies = append(copies, n)
+		return true
+	})
+	origin := map[ast.Node]ast.Node{}
+	for i, n := range nodes {
+		if n != nil {
+			origin[n] = copies[i]
+		}
+	}
+
+	calls := map[ast.Node]bool{}
+	expanded := map[ast.Node]bool{}
+	x := &eval.Expander{
+		Import: eval.FileImporter(filepath.Dir(filename)),
+		OnExpand: func(call *ast.CallExpression, res ast.Node) {
+			calls[origin[call]] = true
+			ast.Inspect(res, func(n ast.Node) bool {
+				expanded[n] = true
+				return true
+			})
+		},
+	}
+	if _, err := x.Expand(program, object.NewEnvironment(nil)); err != nil {
+		return "", fmt.Errorf("expand macros err: %v", err)
+	}
+	return ast.DOT(
+		ast.DotTree{Name: "before", Root: before, Highlight: calls},
+		ast.DotTree{Name: "after", Root: program, Highlight: expanded},
+	), nil
+}
+
+// ioPolicy returns nil if no directory is allowed.
+func ioPolicy(roots string, writable bool) *eval.IOPolicy {
+	if roots == "" {
+		return nil
+	}
+	return &eval.IOPolicy{
+		Roots:    strings.Split(roots, ","),
+		Writable: writable,
+		Stdin:    os.Stdin,
+	}
+}
+
+func parse(filename string) (*ast.Program, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open file err: %v", err)
+	}
+	l := lexer.New(string(b))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// expander returns the macro expander configured by the flags, the expansion is traced to stderr.
+func expander(trace bool, maxDepth int) *eval.Expander {
+	x := &eval.Expander{MaxDepth: maxDepth}
+	if trace {
+		x.Trace = os.Stderr
+	}
+	return x
+}
+
+// load parses the script, then defines and expands the macros in it with x,
+// the macros are imported relative to the directory of the script, unless x has its own Import.
+func load(filename string, env *object.Environment, x *eval.Expander) (*ast.Program, error) {
+	program, err := parse(filename)
+	if err != nil {
+		return nil, err
+	}
+	// let reverse_sub = macro(a, b) {quote(unquote(b) - unquote(a))}
+	//  reverse_sub(1+2, 3+4) --> ((3+4)-(1+2))
+	if x.Import == nil {
+		x.Import = eval.FileImporter(filepath.Dir(filename))
+	}
+	if _, err := x.Expand(program, env); err != nil {
+		return nil, fmt.Errorf("expand macros err: %v", err)
+	}
+	return program, nil
+}
+
+func runFile(filename string, args []string, policy *eval.IOPolicy, x *eval.Expander) int {
+	env := object.NewEnvironment(nil)
+	if policy != nil {
+		if err := eval.EnableIO(env, *policy); err != nil {
+			fmt.Fprintf(os.Stderr, "enable io err: %v\n", err)
+			return 1
+		}
+		// the modules are only imported from the directories the script may read
+		importer, err := eval.SandboxImporter(filepath.Dir(filename), *policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "enable io err: %v\n", err)
+			return 1
+		}
+		x.Import = importer
+	}
+	if err := eval.EnableScript(env, args); err != nil {
+		fmt.Fprintf(os.Stderr, "enable script err: %v\n", err)
+		return 1
+	}
+	program, err := load(filename, env, x)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	// ((3+4)-(1+2)) -> 4
+	_, err = eval.Eval(program, env)
+	var exit *eval.ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eval err: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -2,17 +2,62 @@ package eval
 
 import (
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/ChaosNyaruko/monkey/object"
 )
 
 var builtins = map[string]*object.Builtin{
-	"len":   {Name: "len", Fn: Len},
-	"first": {Name: "first", Fn: First},
-	"last":  {Name: "last", Fn: Last},
-	"rest":  {Name: "rest", Fn: Rest},
-	"push":  {Name: "push", Fn: Push},
+	"len":   {Name: "len", Fn: object.Simple(Len)},
+	"first": {Name: "first", Fn: object.Simple(First)},
+	"last":  {Name: "last", Fn: object.Simple(Last)},
+	"rest":  {Name: "rest", Fn: object.Simple(Rest)},
+	"push":  {Name: "push", Fn: object.Simple(Push)},
 	"print": {Name: "print", Fn: Print},
+	"exit":  {Name: "exit", Fn: object.Simple(Exit)},
+	"parse": {Name: "parse", Fn: object.Simple(Parse)},
+
+	// the output goes to the writers set by the host, see object.Environment.SetOutput.
+	"println": {Name: "println", Fn: Println},
+	"printf":  {Name: "printf", Fn: Printf},
+	"eprint":  {Name: "eprint", Fn: Eprint},
+
+	"keys":   {Name: "keys", Fn: object.Simple(Keys)},
+	"values": {Name: "values", Fn: object.Simple(Values)},
+	"items":  {Name: "items", Fn: object.Simple(Items)},
+	"has":    {Name: "has", Fn: object.Simple(Has)},
+	"delete": {Name: "delete", Fn: object.Simple(Delete)},
+	"merge":  {Name: "merge", Fn: object.Simple(Merge)},
+
+	// the collection builtins, the ones taking a function call it back through the context.
+	"map":       {Name: "map", Fn: Map},
+	"filter":    {Name: "filter", Fn: Filter},
+	"reduce":    {Name: "reduce", Fn: Reduce},
+	"each":      {Name: "each", Fn: Each},
+	"any":       {Name: "any", Fn: Any},
+	"all":       {Name: "all", Fn: All},
+	"find":      {Name: "find", Fn: Find},
+	"sort":      {Name: "sort", Fn: Sort},
+	"sort_by":   {Name: "sort_by", Fn: SortBy},
+	"zip":       {Name: "zip", Fn: object.Simple(Zip)},
+	"range":     {Name: "range", Fn: object.Simple(Range)},
+	"enumerate": {Name: "enumerate", Fn: object.Simple(Enumerate)},
+	"flatten":   {Name: "flatten", Fn: object.Simple(Flatten)},
+	"uniq":      {Name: "uniq", Fn: object.Simple(Uniq)},
+	"group_by":  {Name: "group_by", Fn: GroupBy},
+
+	// environment variables are only visible to scripts, see EnableScript.
+	"env": {Name: "env", Fn: object.Simple(func(args ...object.Object) (object.Object, error) {
+		return nil, fmt.Errorf("env: environment access is not enabled by the host\n")
+	})},
+
+	// I/O builtins are sandboxed by default, see EnableIO.
+	"read_file":  {Name: "read_file", Fn: object.Simple(ioDisabled("read_file"))},
+	"write_file": {Name: "write_file", Fn: object.Simple(ioDisabled("write_file"))},
+	"read_lines": {Name: "read_lines", Fn: object.Simple(ioDisabled("read_lines"))},
+	"read_stdin": {Name: "read_stdin", Fn: object.Simple(ioDisabled("read_stdin"))},
+	"list_dir":   {Name: "list_dir", Fn: object.Simple(ioDisabled("list_dir"))},
 }
 
 func Len(args ...object.Object) (object.Object, error) {
@@ -29,6 +74,10 @@ func Len(args ...object.Object) (object.Object, error) {
 		return &object.Integer{
 			Value: len(s.Elements),
 		}, nil
+	case *object.Hash:
+		return &object.Integer{
+			Value: s.Len(),
+		}, nil
 	default:
 		return nil, fmt.Errorf("not supported on %v\n", a.Type())
 	}
@@ -103,14 +152,161 @@ func Push(args ...object.Object) (object.Object, error) {
 	}
 }
 
-func Print(args ...object.Object) (object.Object, error) {
-	for i, a := range args {
-		fmt.Print(a.Inspect())
-		if i != len(args)-1 {
-			fmt.Print(" ")
-		} else {
-			fmt.Println()
+// Print writes the arguments separated by spaces and a newline to the output, nothing without arguments.
+func Print(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return NULL, nil
+	}
+	return NULL, fprintln(ctx.Out, args)
+}
+
+// Println is Print, but it writes a newline without arguments.
+func Println(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	return NULL, fprintln(ctx.Out, args)
+}
+
+// Eprint is Print to the error output.
+func Eprint(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return NULL, nil
+	}
+	return NULL, fprintln(ctx.ErrOut, args)
+}
+
+func fprintln(w io.Writer, args []object.Object) error {
+	s := make([]string, 0, len(args))
+	for _, a := range args {
+		s = append(s, a.Inspect())
+	}
+	_, err := fmt.Fprintln(w, strings.Join(s, " "))
+	return err
+}
+
+// Printf writes the arguments formatted like fmt.Printf, printf("%s is %d", name, age).
+// Integers, strings and booleans are passed as they are, the other objects as what print writes.
+func Printf(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments, expected at least %d, but got %d", 1, len(args))
+	}
+	format, ok := args[0].(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("printf: the format should be a STRING, but got %v", args[0].Type())
+	}
+	values := make([]any, 0, len(args)-1)
+	for _, a := range args[1:] {
+		switch a := a.(type) {
+		case *object.Integer:
+			values = append(values, a.Value)
+		case *object.String:
+			values = append(values, a.Value)
+		case *object.Boolean:
+			values = append(values, a.Value)
+		default:
+			values = append(values, a.Inspect())
+		}
+	}
+	_, err := fmt.Fprintf(ctx.Out, format.Value, values...)
+	return NULL, err
+}
+
+func hashArg(args []object.Object, n int) (*object.Hash, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", n, len(args))
+	}
+	h, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, fmt.Errorf("not supported on %v\n", args[0].Type())
+	}
+	return h, nil
+}
+
+func hashableArg(arg object.Object) (object.Hashable, error) {
+	k, ok := object.AsHashable(arg)
+	if !ok {
+		return nil, fmt.Errorf("%v is not hashable\n", arg.Type())
+	}
+	return k, nil
+}
+
+// Keys returns the keys of a hash in insertion order.
+func Keys(args ...object.Object) (object.Object, error) {
+	h, err := hashArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, h.Len())}
+	for _, p := range h.Pairs() {
+		res.Elements = append(res.Elements, p.Key)
+	}
+	return res, nil
+}
+
+// Values returns the values of a hash in insertion order.
+func Values(args ...object.Object) (object.Object, error) {
+	h, err := hashArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, h.Len())}
+	for _, p := range h.Pairs() {
+		res.Elements = append(res.Elements, p.Value)
+	}
+	return res, nil
+}
+
+// Items returns the [key, value] pairs of a hash in insertion order.
+func Items(args ...object.Object) (object.Object, error) {
+	h, err := hashArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, h.Len())}
+	for _, p := range h.Pairs() {
+		res.Elements = append(res.Elements, &object.Array{Elements: []object.Object{p.Key, p.Value}})
+	}
+	return res, nil
+}
+
+func Has(args ...object.Object) (object.Object, error) {
+	h, err := hashArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	k, err := hashableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	_, ok := h.Get(k)
+	return boolToBoolean(ok), nil
+}
+
+// Delete returns a new hash without the key, the original one is not changed.
+func Delete(args ...object.Object) (object.Object, error) {
+	h, err := hashArg(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	k, err := hashableArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	res := h.Copy()
+	res.Delete(k)
+	return res, nil
+}
+
+// Merge returns a new hash with the pairs of all the arguments, the later ones win.
+// Keys keep the position where they first appear.
+func Merge(args ...object.Object) (object.Object, error) {
+	res := &object.Hash{}
+	for _, a := range args {
+		h, ok := a.(*object.Hash)
+		if !ok {
+			return nil, fmt.Errorf("not supported on %v\n", a.Type())
+		}
+		for _, p := range h.Pairs() {
+			res.Set(p.Key.(object.Hashable), p.Value)
 		}
 	}
-	return NULL, nil
+	return res, nil
 }
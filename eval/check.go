@@ -0,0 +1,172 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// specialForms are handled by Eval itself instead of being looked up.
+var specialForms = map[string]bool{
+	"quote":   true,
+	"unquote": true,
+	"eval":    true,
+
+	"unquote_splice": true,
+}
+
+// Check statically checks the (macro-expanded) program without running it,
+// reporting identifiers which are never defined.
+// Names already bound in env and the builtins are considered as defined.
+func Check(p *ast.Program, env *object.Environment) []error {
+	c := &checker{env: env}
+	s := &scope{names: map[string]bool{}}
+	for _, stmt := range p.Statements {
+		c.check(stmt, s)
+	}
+	c.close(s)
+	return c.errs
+}
+
+// scope is the set of names bound by a program or a function body.
+// Blocks don't introduce scopes, a let in an if branch is visible to the whole function.
+type scope struct {
+	names   map[string]bool
+	pending []*ast.Identifier // identifiers not resolved yet, they may be defined later in the scope
+	parent  *scope
+}
+
+// bind defines the names bound by a pattern, e.g. the name of a let statement.
+func (s *scope) bind(pattern ast.Expression) {
+	names, _ := patternNames(pattern)
+	for _, id := range names {
+		s.names[id.Value] = true
+	}
+}
+
+type checker struct {
+	env  *object.Environment
+	errs []error
+}
+
+// close resolves the pending identifiers of s, the unresolved ones are passed to the parent scope.
+func (c *checker) close(s *scope) {
+	for _, id := range s.pending {
+		if s.names[id.Value] {
+			continue
+		}
+		if s.parent != nil {
+			s.parent.pending = append(s.parent.pending, id)
+			continue
+		}
+		if _, err := c.env.Get(id.Value); err == nil {
+			continue
+		}
+		if _, ok := builtins[id.Value]; ok || specialForms[id.Value] {
+			continue
+		}
+		c.errs = append(c.errs, fmt.Errorf("undefined identifier: %s", id.Value))
+	}
+}
+
+func (c *checker) checkFunction(params []ast.Expression, body *ast.BlockStatement, parent *scope) {
+	s := &scope{names: map[string]bool{}, parent: parent}
+	for _, p := range params {
+		switch p := p.(type) {
+		case *ast.Identifier:
+			s.names[p.Value] = true
+		case *ast.RestExpression:
+			s.names[p.Name.Value] = true
+		case *ast.ArrayLiteral, *ast.HashLiteral:
+			s.bind(p)
+		default:
+			c.check(p, parent)
+		}
+	}
+	c.check(body, s)
+	c.close(s)
+}
+
+func (c *checker) check(node ast.Node, s *scope) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if node == nil {
+			return
+		}
+		for _, stmt := range node.Statements {
+			c.check(stmt, s)
+		}
+	case *ast.ExpressionStatement:
+		c.check(node.Expression, s)
+	case *ast.LetStatement:
+		s.bind(node.Name)
+		c.check(node.Value, s)
+	case *ast.ReturnStatement:
+		c.check(node.ReturnValue, s)
+	case *ast.Identifier:
+		s.pending = append(s.pending, node)
+	case *ast.PrefixExpression:
+		c.check(node.Rhs, s)
+	case *ast.InfixExpression:
+		c.check(node.Lhs, s)
+		c.check(node.Rhs, s)
+	case *ast.IfExpression:
+		c.check(node.Condition, s)
+		c.check(node.If, s)
+		c.check(node.Else, s)
+	case *ast.FunctionLiteral:
+		c.checkFunction(node.Parameters, node.Body, s)
+	case *ast.MacroLiteral:
+		c.checkFunction(node.Parameters, node.Body, s)
+	case *ast.CallExpression:
+		if node.F.TokenLiteral() == "quote" {
+			// quoted code is data, only the unquoted parts will be evaluated.
+			for _, a := range node.Arguments {
+				c.checkQuoted(a, s)
+			}
+			return
+		}
+		c.check(node.F, s)
+		for _, a := range node.Arguments {
+			c.check(a, s)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			c.check(e, s)
+		}
+	case *ast.HashLiteral:
+		for _, p := range node.Pairs {
+			c.check(p.Key, s)
+			c.check(p.Value, s)
+		}
+	case *ast.IndexExpression:
+		c.check(node.Left, s)
+		c.check(node.Index, s)
+	case *ast.SliceExpression:
+		c.check(node.Left, s)
+		c.check(node.Low, s)
+		c.check(node.High, s)
+	case *ast.MatchExpression:
+		c.check(node.Value, s)
+		for _, a := range node.Arms {
+			// the names bound by the pattern are only visible in the arm
+			arm := &scope{names: map[string]bool{}, parent: s}
+			arm.bind(a.Pattern)
+			c.check(a.Guard, arm)
+			c.check(a.Body, arm)
+			c.close(arm)
+		}
+	}
+}
+
+// checkQuoted looks for the unquote calls inside a quoted node.
+func (c *checker) checkQuoted(node ast.Node, s *scope) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if code, ok := unquoted(n); ok {
+			c.check(code, s)
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,46 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+func TestCheck(t *testing.T) {
+	type testcase struct {
+		input    string
+		expected []string
+	}
+	for _, tc := range []testcase{
+		{`let a = 1; a + len("x")`, nil},
+		{`a + 1`, []string{"undefined identifier: a"}},
+		{`let f = fn(x) { x + y }; let g = fn() { f(1) + h() }; let h = fn() { 1 };`, []string{"undefined identifier: y"}},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };`, nil},
+		{`let f = fn() { if (true) { let v = 1; } v };`, nil},
+		{`let f = fn(p) { p }; p`, []string{"undefined identifier: p"}},
+		{`quote(foo + unquote(bar))`, []string{"undefined identifier: bar"}},
+		{`quote(foo(1, unquote(bar)))`, []string{"undefined identifier: bar"}},
+		{`let m = macro(a) { quote(unquote(a)) }; m(zoo)`, []string{"undefined identifier: zoo"}},
+		{`args; env("HOME")`, nil},
+		{`let [a, ...r] = [1]; let {name, k: v} = {}; let f = fn([x], {y}) { a + r + name + v + x + y + k };`, []string{"undefined identifier: k"}},
+		{`match ([1]) { [a, ...r] if a > b => r, {name: n} => n + name, _ => a }`, []string{"undefined identifier: b", "undefined identifier: name", "undefined identifier: a"}},
+	} {
+		program, err := stringToAst(tc.input)
+		require.Nil(t, err)
+		env := object.NewEnvironment(nil)
+		require.Nil(t, EnableScript(env, nil))
+		require.Nil(t, DefineMacros(program.(*ast.Program), env))
+		_, err = ExpandMacros(program.(*ast.Program), env)
+		require.Nil(t, err)
+
+		var got []string
+		for _, err := range Check(program.(*ast.Program), env) {
+			got = append(got, err.Error())
+		}
+		assert.Equal(t, tc.expected, got, "input: %v", tc.input)
+	}
+}
@@ -0,0 +1,413 @@
+package eval
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// arrayArg checks the number of arguments, which is between min and max, and returns the first one as an array.
+func arrayArg(args []object.Object, min, max int) (*object.Array, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", min, len(args))
+		}
+		return nil, fmt.Errorf("wrong number of arguments, expected %d to %d, but got %d\n", min, max, len(args))
+	}
+	a, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, fmt.Errorf("not supported on %v\n", args[0].Type())
+	}
+	return a, nil
+}
+
+// Map returns the results of f for each element, map(arr, f).
+func Map(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, len(a.Elements))}
+	for _, e := range a.Elements {
+		v, err := ctx.Call(args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		res.Elements = append(res.Elements, v)
+	}
+	return res, nil
+}
+
+// Filter returns the elements for which f is true, filter(arr, f).
+func Filter(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: []object.Object{}}
+	for _, e := range a.Elements {
+		ok, err := test(ctx, args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res.Elements = append(res.Elements, e)
+		}
+	}
+	return res, nil
+}
+
+// Reduce folds the elements from left to right with f(acc, e), reduce(arr, f, initial).
+// Without the initial value, the first element is the initial one, and the array should not be empty.
+func Reduce(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	elements := a.Elements
+	var acc object.Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else {
+		if len(elements) == 0 {
+			return nil, fmt.Errorf("reduce of an empty array with no initial value\n")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+	for _, e := range elements {
+		if acc, err = ctx.Call(args[1], acc, e); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// Each calls f for each element, each(arr, f).
+func Each(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range a.Elements {
+		if _, err := ctx.Call(args[1], e); err != nil {
+			return nil, err
+		}
+	}
+	return NULL, nil
+}
+
+// Any reports whether f is true for any element, any(arr, f).
+func Any(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range a.Elements {
+		ok, err := test(ctx, args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return TRUE, nil
+		}
+	}
+	return FALSE, nil
+}
+
+// All reports whether f is true for all the elements, all(arr, f).
+func All(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range a.Elements {
+		ok, err := test(ctx, args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return FALSE, nil
+		}
+	}
+	return TRUE, nil
+}
+
+// Find returns the first element for which f is true, or null, find(arr, f).
+func Find(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range a.Elements {
+		ok, err := test(ctx, args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return e, nil
+		}
+	}
+	return NULL, nil
+}
+
+func test(ctx *object.Context, f, e object.Object) (bool, error) {
+	v, err := ctx.Call(f, e)
+	if err != nil {
+		return false, err
+	}
+	return isTrue(v), nil
+}
+
+// Sort returns a sorted copy of an array of integers or strings, sort(arr),
+// or of any array with a comparator less(a, b) which is true if a goes before b, sort(arr, less).
+// The sort is stable.
+func Sort(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	less := func(x, y object.Object) (bool, error) {
+		c, err := compare(x, y)
+		return c < 0, err
+	}
+	if len(args) == 2 {
+		less = func(x, y object.Object) (bool, error) {
+			return test2(ctx, args[1], x, y)
+		}
+	}
+	return sorted(a.Elements, a.Elements, less)
+}
+
+// SortBy returns a copy of an array sorted by the keys f(e), which are integers or strings, sort_by(arr, f).
+// The sort is stable.
+func SortBy(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Map(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return sorted(a.Elements, m.(*object.Array).Elements, func(x, y object.Object) (bool, error) {
+		c, err := compare(x, y)
+		return c < 0, err
+	})
+}
+
+func test2(ctx *object.Context, f, x, y object.Object) (bool, error) {
+	v, err := ctx.Call(f, x, y)
+	if err != nil {
+		return false, err
+	}
+	return isTrue(v), nil
+}
+
+// sorted sorts a copy of the elements by their keys, the first error stops the sort.
+func sorted(elements, keys []object.Object, less func(x, y object.Object) (bool, error)) (object.Object, error) {
+	idx := make([]int, len(elements))
+	for i := range idx {
+		idx[i] = i
+	}
+	var err error
+	sort.SliceStable(idx, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		var ok bool
+		ok, err = less(keys[idx[i]], keys[idx[j]])
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, len(elements))}
+	for _, i := range idx {
+		res.Elements = append(res.Elements, elements[i])
+	}
+	return res, nil
+}
+
+// compare compares two integers or two strings.
+func compare(x, y object.Object) (int, error) {
+	switch x := x.(type) {
+	case *object.Integer:
+		if y, ok := y.(*object.Integer); ok {
+			return cmp.Compare(x.Value, y.Value), nil
+		}
+	case *object.String:
+		if y, ok := y.(*object.String); ok {
+			return strings.Compare(x.Value, y.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s and %s\n", x.Type(), y.Type())
+}
+
+// Zip returns the arrays of the ith elements of the arrays, as long as the shortest one, zip(a, b, ...).
+func Zip(args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments, expected at least %d, but got %d\n", 1, len(args))
+	}
+	arrays := make([]*object.Array, 0, len(args))
+	n := -1
+	for _, arg := range args {
+		a, ok := arg.(*object.Array)
+		if !ok {
+			return nil, fmt.Errorf("not supported on %v\n", arg.Type())
+		}
+		if n < 0 || len(a.Elements) < n {
+			n = len(a.Elements)
+		}
+		arrays = append(arrays, a)
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, n)}
+	for i := 0; i < n; i++ {
+		t := &object.Array{Elements: make([]object.Object, 0, len(arrays))}
+		for _, a := range arrays {
+			t.Elements = append(t.Elements, a.Elements[i])
+		}
+		res.Elements = append(res.Elements, t)
+	}
+	return res, nil
+}
+
+// MaxRange is the maximum number of the elements of a range.
+const MaxRange = 1 << 24
+
+// Range returns the integers from start (0 by default) up to but not including end, range(end),
+// range(start, end) or range(start, end, step), a negative step counts down.
+func Range(args ...object.Object) (object.Object, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d to %d, but got %d\n", 1, 3, len(args))
+	}
+	nums := make([]int, 0, len(args))
+	for _, arg := range args {
+		i, ok := arg.(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("not supported on %v\n", arg.Type())
+		}
+		nums = append(nums, i.Value)
+	}
+	start, end, step := 0, nums[0], 1
+	if len(nums) > 1 {
+		start, end = nums[0], nums[1]
+	}
+	if len(nums) > 2 {
+		step = nums[2]
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("range: the step should not be 0\n")
+	}
+	// the number of the elements, counted in uint64 since the distance and the step may not fit in an int
+	var n uint64
+	if step > 0 && start < end {
+		n = (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	} else if step < 0 && start > end {
+		n = (uint64(start)-uint64(end)-1)/uint64(-step) + 1
+	}
+	if n > MaxRange {
+		return nil, fmt.Errorf("range: %d elements are more than %d\n", n, MaxRange)
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, n)}
+	for i := uint64(0); i < n; i++ {
+		res.Elements = append(res.Elements, &object.Integer{Value: start + int(i)*step})
+	}
+	return res, nil
+}
+
+// Enumerate returns the [index, element] pairs of an array, enumerate(arr).
+func Enumerate(args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: make([]object.Object, 0, len(a.Elements))}
+	for i, e := range a.Elements {
+		res.Elements = append(res.Elements, &object.Array{Elements: []object.Object{&object.Integer{Value: i}, e}})
+	}
+	return res, nil
+}
+
+// Flatten returns the elements of the nested arrays in a single array, at any depth, flatten(arr).
+func Flatten(args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: []object.Object{}}
+	var flatten func(a *object.Array)
+	flatten = func(a *object.Array) {
+		for _, e := range a.Elements {
+			if inner, ok := e.(*object.Array); ok {
+				flatten(inner)
+			} else {
+				res.Elements = append(res.Elements, e)
+			}
+		}
+	}
+	flatten(a)
+	return res, nil
+}
+
+// Uniq returns the elements without the duplicates, keeping the first ones, uniq(arr).
+func Uniq(args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Array{Elements: []object.Object{}}
+	seen := &object.Hash{}
+	for _, e := range a.Elements {
+		if k, ok := object.AsHashable(e); ok {
+			if _, dup := seen.Get(k); dup {
+				continue
+			}
+			seen.Set(k, TRUE)
+		} else if containsObject(res.Elements, e) {
+			// e.g. a function, which is only equal to itself
+			continue
+		}
+		res.Elements = append(res.Elements, e)
+	}
+	return res, nil
+}
+
+func containsObject(list []object.Object, o object.Object) bool {
+	for _, e := range list {
+		if object.Equal(e, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupBy returns a hash from the keys f(e) to the arrays of the elements having them, group_by(arr, f).
+// The keys and the elements are in the order they first appear.
+func GroupBy(ctx *object.Context, args ...object.Object) (object.Object, error) {
+	a, err := arrayArg(args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	res := &object.Hash{}
+	for _, e := range a.Elements {
+		v, err := ctx.Call(args[1], e)
+		if err != nil {
+			return nil, err
+		}
+		k, err := hashableArg(v)
+		if err != nil {
+			return nil, err
+		}
+		group, ok := res.Get(k)
+		if !ok {
+			group = &object.Array{}
+			res.Set(k, group)
+		}
+		g := group.(*object.Array)
+		g.Elements = append(g.Elements, e)
+	}
+	return res, nil
+}
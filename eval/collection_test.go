@@ -0,0 +1,68 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2,4,6]", ""},
+		{`map([], fn(x) { x })`, "[]", ""},
+		{`map(["a", "bc"], len)`, "[1,2]", ""},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3,4]", ""},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 10)`, "20", ""},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc * x })`, "24", ""},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, "0", ""},
+		{`each([1, 2], fn(x) { x })`, "null", ""},
+		{`[any([1, 2], fn(x) { x > 1 }), any([], fn(x) { true })]`, "[true,false]", ""},
+		{`[all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`, "[false,true]", ""},
+		{`[find([1, 2, 3], fn(x) { x > 1 }), find([1], fn(x) { x > 1 })]`, "[2,null]", ""},
+		{`sort([3, 1, 2])`, "[1,2,3]", ""},
+		{`sort(["b", "c", "a"])`, "[a,b,c]", ""},
+		// the difference of the integers overflows
+		{`sort([2, -9223372036854775807, 9223372036854775807, -2])`, "[-9223372036854775807,-2,2,9223372036854775807]", ""},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3,2,1]", ""},
+		{`let a = [2, 1]; let b = sort(a); [a, b]`, "[[2,1],[1,2]]", ""},
+		{`sort_by([[1, "b"], [2, "a"], [3, "b"]], fn(p) { p[1] })`, "[[2,a],[1,b],[3,b]]", ""},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1,a],[2,b]]", ""},
+		{`zip([1], [2], [3])`, "[[1,2,3]]", ""},
+		{`[range(3), range(1, 4), range(5, 0, -2), range(3, 1)]`, "[[0,1,2],[1,2,3],[5,3,1],[]]", ""},
+		// the steps don't overflow near the limits of the integers
+		{`[range(9223372036854775806, 9223372036854775807, 2), range(-9223372036854775806, -9223372036854775807, -2)]`, "[[9223372036854775806],[-9223372036854775806]]", ""},
+		{`range(-9223372036854775807, 9223372036854775807, 9223372036854775807)`, "[-9223372036854775807,0]", ""},
+		{`enumerate(["a", "b"])`, "[[0,a],[1,b]]", ""},
+		{`flatten([1, [2, [3, []]], 4])`, "[1,2,3,4]", ""},
+		{`uniq([1, 2, 1, [1], [1], "1"])`, "[1,2,[1],1]", ""},
+		{`let f = fn() { 1 }; len(uniq([f, f, fn() { 1 }]))`, "2", ""},
+		{`group_by([1, 4, 2, 5, 3], fn(x) { x > 2 })`, "{false:[1,2],true:[4,5,3]}", ""},
+		// the builtins can be shadowed, e.g. by a script defining its own map
+		{`let map = fn(arr, f) { "mine" }; map([1], fn(x) { x })`, "mine", ""},
+		{`map([1], fn(x, y) { x })`, "", "wrong number of arguments: want=2, got=1"},
+		{`map(1, fn(x) { x })`, "", "not supported on INTEGER"},
+		{`map([1], 1)`, "", "1 is not callable"},
+		{`filter([1])`, "", "wrong number of arguments, expected 2, but got 1"},
+		{`reduce([], fn(acc, x) { acc + x })`, "", "reduce of an empty array with no initial value"},
+		{`sort([1, "a"])`, "", "cannot compare"},
+		{`sort([1, 2], fn(a, b) { c })`, "", "undefined identifier: c"},
+		{`range(1, 2, 0)`, "", "range: the step should not be 0"},
+		{`range(-9223372036854775807, 9223372036854775807)`, "", "range: 18446744073709551614 elements are more than 16777216"},
+		{`group_by([1], fn(x) { fn() { x } })`, "", "FUNCTION is not hashable"},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		if !assert.Nil(t, err, "input: %v", tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+}
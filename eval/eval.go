@@ -76,6 +76,8 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		return evalHashLiteral(node, env)
 	case *ast.IndexExpression:
 		return evalIndexExpression(node, env)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.StringLiteral:
 		return &object.String{
 			Value: node.Value,
@@ -111,8 +113,14 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		if err != nil {
 			return nil, err
 		}
-		_, err = env.Set(node.Name.Value, val)
-		return NULL, err
+		if id, ok := node.Name.(*ast.Identifier); ok {
+			_, err = env.Set(id.Value, val)
+			return NULL, err
+		}
+		if err := destructure(node.Name, val, env); err != nil {
+			return nil, fmt.Errorf("%s: %w", node.Token.Pos, err)
+		}
+		return NULL, nil
 	case *ast.Identifier:
 		// TODO: let x = (let c = 1);
 		return evalIdentifier(node, env)
@@ -122,8 +130,15 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		return &object.ReturnValue{
 			Value: rValue,
 		}, err
+	case *ast.MatchExpression:
+		return evalMatch(node, env)
+	case *ast.RestExpression:
+		return nil, fmt.Errorf("%s is only allowed at the end of a pattern or the parameters of a macro\n", node.String())
 	case *ast.FunctionLiteral:
-		params := node.Parameters
+		params, err := parameters(node.Parameters)
+		if err != nil {
+			return nil, err
+		}
 		body := node.Body
 		return &object.Function{
 			Parameters: params,
@@ -132,10 +147,7 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		}, nil
 	case *ast.CallExpression:
 		if node.F.TokenLiteral() == "eval" {
-			if len(node.Arguments) != 1 {
-				return nil, fmt.Errorf("eval should and only should have one argument\n")
-			}
-			return evalLiteral(node.Arguments[0], env)
+			return evalLiteral(node.Arguments, env)
 		}
 		if node.F.TokenLiteral() == "quote" {
 			if len(node.Arguments) != 1 {
@@ -152,17 +164,36 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, error) {
 		if err != nil {
 			return nil, err
 		}
-		return callFunction(f, args)
+		return callFunction(callContext(env, callPos(node)), f, args)
 	}
 	return nil, fmt.Errorf("unsupported object type: %T\n", node)
 }
 
-func callFunction(fn object.Object, args []object.Object) (object.Object, error) {
+// callContext is the context of a call at pos in env, the builtins get it.
+func callContext(env *object.Environment, pos token.Position) *object.Context {
+	out, errOut := env.Output()
+	ctx := &object.Context{Context: env.Context(), Out: out, ErrOut: errOut, Env: env, Pos: pos}
+	ctx.Call = func(fn object.Object, args ...object.Object) (object.Object, error) {
+		return callFunction(ctx, fn, args)
+	}
+	return ctx
+}
+
+func callFunction(ctx *object.Context, fn object.Object, args []object.Object) (object.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: the evaluation is stopped: %w\n", ctx.Pos, err)
+	}
 	switch f := fn.(type) {
 	case *object.Function:
+		// the extra arguments are ignored
+		if len(args) < len(f.Parameters) {
+			return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d\n", len(f.Parameters), len(args))
+		}
 		newEnv := object.NewEnvironment(f.Env)
 		for i, p := range f.Parameters {
-			newEnv.Set(p.Value, args[i])
+			if err := destructure(p, args[i], newEnv); err != nil {
+				return nil, err
+			}
 		}
 
 		val, err := Eval(f.Body, newEnv)
@@ -174,7 +205,7 @@ func callFunction(fn object.Object, args []object.Object) (object.Object, error)
 		}
 		return val, nil
 	case *object.Builtin:
-		return f.Fn(args...)
+		return f.Fn(ctx, args...)
 	}
 	return nil, fmt.Errorf("%v is not callable", fn.Inspect())
 }
@@ -184,7 +215,7 @@ func evalExpressions(args []ast.Expression, env *object.Environment) ([]object.O
 	for _, a := range args {
 		v, err := Eval(a, env)
 		if err != nil {
-			return nil, fmt.Errorf("passing exp error: [%v]%v", a, err)
+			return nil, fmt.Errorf("passing exp error: [%v]%w", a, err)
 		}
 		res = append(res, v)
 	}
@@ -211,13 +242,9 @@ func evalInfixString(op string, l, r *object.String) (object.Object, error) {
 			Value: l.Value + r.Value,
 		}, nil
 	case "==":
-		return &object.Boolean{
-			Value: l.Value == r.Value,
-		}, nil
+		return boolToBoolean(l.Value == r.Value), nil
 	case "!=":
-		return &object.Boolean{
-			Value: l.Value != r.Value,
-		}, nil
+		return boolToBoolean(l.Value != r.Value), nil
 	}
 	return nil, fmt.Errorf("unsupported infix operator for strings: %q %s %q\n", l.Inspect(), op, r.Inspect())
 }
@@ -263,14 +290,12 @@ func evalInfixExpression(op string, lhs, rhs object.Object) (object.Object, erro
 		return evalInfixString(op, l, r)
 	}
 
-	if lType == object.BOOLEAN_OBJ && rType == object.BOOLEAN_OBJ {
-		switch op {
-		case "==":
-			return boolToBoolean(lhs == rhs), nil
-		case "!=":
-			return boolToBoolean(lhs != rhs), nil
-		}
-		return nil, fmt.Errorf("illegal operands for %q, lhs: %q, rhs: %q\n", op, lhs.Inspect(), rhs.Inspect())
+	// other values can only be compared, structurally for arrays and hashes.
+	switch op {
+	case "==":
+		return boolToBoolean(object.Equal(lhs, rhs)), nil
+	case "!=":
+		return boolToBoolean(!object.Equal(lhs, rhs)), nil
 	}
 	return nil, fmt.Errorf("illegal operands for %q, lhs: %q, rhs: %q\n", op, lhs.Inspect(), rhs.Inspect())
 }
@@ -345,29 +370,25 @@ func evalBlockStatements(stmts []ast.Statement, env *object.Environment) (object
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) (object.Object, error) {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
 	var err error
-	for key, value := range node.Pairs {
+	for _, p := range node.Pairs {
+		key, value := p.Key, p.Value
 		var k, v object.Object
 		if k, err = Eval(key, env); err != nil {
-			return nil, fmt.Errorf("eval key: %s err: %v\n", key.String(), err)
+			return nil, fmt.Errorf("eval key: %s err: %w", key.String(), err)
 		}
-		hk, ok := k.(object.Hashable)
+		hk, ok := object.AsHashable(k)
 		if !ok {
 			return nil, fmt.Errorf("%v is not hashable\n", k.Type())
 		}
 		if v, err = Eval(value, env); err != nil {
-			return nil, fmt.Errorf("eval key: %s err: %v\n", key.String(), err)
-		}
-		pairs[hk.HashKey()] = object.HashPair{
-			Key:   k,
-			Value: v,
+			return nil, fmt.Errorf("eval key: %s err: %w", key.String(), err)
 		}
+		hash.Set(hk, v)
 	}
-	return &object.Hash{
-		Pairs: pairs,
-	}, nil
+	return hash, nil
 }
 
 func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) (object.Object, error) {
@@ -381,37 +402,117 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) (ob
 	}
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
+		return evalArrayIndexExpression(node, left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(node, left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	}
 	return nil, fmt.Errorf("index %s on %s is not supported", index.Type(), left.Type())
 }
 
-func evalArrayIndexExpression(array, int object.Object) (object.Object, error) {
+// a negative index counts from the end, -1 is the last one.
+func evalArrayIndexExpression(node *ast.IndexExpression, array, int object.Object) (object.Object, error) {
 	a := array.(*object.Array)
 	i := int.(*object.Integer)
-	if i.Value >= len(a.Elements) || i.Value < 0 {
-		return nil, fmt.Errorf("index out of bounds, len:%d, visit:%d\n", len(a.Elements), i.Value)
+	idx := i.Value
+	if idx < 0 {
+		idx += len(a.Elements)
+	}
+	if idx >= len(a.Elements) || idx < 0 {
+		return nil, fmt.Errorf("%s: index out of bounds, len:%d, visit:%d\n", node.Token.Pos, len(a.Elements), i.Value)
+	}
+	return a.Elements[idx], nil
+}
+
+// a string is indexed by bytes like len, the result is a string of one byte.
+func evalStringIndexExpression(node *ast.IndexExpression, str, int object.Object) (object.Object, error) {
+	s := str.(*object.String)
+	i := int.(*object.Integer)
+	idx := i.Value
+	if idx < 0 {
+		idx += len(s.Value)
+	}
+	if idx >= len(s.Value) || idx < 0 {
+		return nil, fmt.Errorf("%s: index out of bounds, len:%d, visit:%d\n", node.Token.Pos, len(s.Value), i.Value)
 	}
-	return a.Elements[i.Value], nil
+	return &object.String{Value: s.Value[idx : idx+1]}, nil
+}
+
+// evalSliceExpression evaluates left[low:high] of an array or a string, low defaults to 0 and high to the length,
+// negative bounds count from the end.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) (object.Object, error) {
+	left, err := Eval(node.Left, env)
+	if err != nil {
+		return nil, err
+	}
+	var length int
+	switch l := left.(type) {
+	case *object.Array:
+		length = len(l.Elements)
+	case *object.String:
+		length = len(l.Value)
+	default:
+		return nil, fmt.Errorf("%s: slice on %s is not supported\n", node.Token.Pos, left.Type())
+	}
+	low, err := sliceBound(node, node.Low, 0, env)
+	if err != nil {
+		return nil, err
+	}
+	high, err := sliceBound(node, node.High, length, env)
+	if err != nil {
+		return nil, err
+	}
+	from, to := low, high
+	if from < 0 {
+		from += length
+	}
+	if to < 0 {
+		to += length
+	}
+	if from < 0 || to > length || from > to {
+		return nil, fmt.Errorf("%s: slice bounds out of range [%d:%d] with length %d\n", node.Token.Pos, low, high, length)
+	}
+	if l, ok := left.(*object.String); ok {
+		return &object.String{Value: l.Value[from:to]}, nil
+	}
+	elements := make([]object.Object, to-from)
+	copy(elements, left.(*object.Array).Elements[from:to])
+	return &object.Array{Elements: elements}, nil
+}
+
+func sliceBound(node *ast.SliceExpression, bound ast.Expression, omitted int, env *object.Environment) (int, error) {
+	if bound == nil {
+		return omitted, nil
+	}
+	v, err := Eval(bound, env)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := v.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("%s: slice bound should be an INTEGER, but got %s\n", node.Token.Pos, v.Type())
+	}
+	return i.Value, nil
 }
 
 func evalHashIndexExpression(hm, key object.Object) (object.Object, error) {
 	a := hm.(*object.Hash)
-	i, ok := key.(object.Hashable)
+	i, ok := object.AsHashable(key)
 	if !ok {
 		return nil, fmt.Errorf("%v is not hashable\n", key.Type())
 	}
-	res, ok := a.Pairs[i.HashKey()]
+	res, ok := a.Get(i)
 	if !ok {
 		return NULL, nil
 	}
-	return res.Value, nil
+	return res, nil
 }
 
 func quote(node ast.Node, env *object.Environment) (object.Object, error) {
-	node, err := evalUnquote(node, env)
+	// unquoting modifies the tree, work on a copy so that the quoted code, e.g. a macro body,
+	// is still the same next time.
+	node, err := evalUnquote(ast.Clone(node), env)
 	return &object.Quote{
 		Node: node,
 	}, err
@@ -419,23 +520,31 @@ func quote(node ast.Node, env *object.Environment) (object.Object, error) {
 
 func evalUnquote(quoted ast.Node, env *object.Environment) (ast.Node, error) {
 	// (quote 1 2 (+ 3 4) unquote(2+3)) -> (quote 1 2 (+3 4) 5)
-	f := func(node ast.Node) ast.Node {
+	f := func(node ast.Node) (ast.Node, error) {
+		if err := splice(node, env); err != nil {
+			return nil, err
+		}
 		// node is unquote or not
 		if !isUnquote(node) {
-			return node
+			return node, nil
 		}
 
 		call := node.(*ast.CallExpression)
-		n, err := evalNewAstNode(call.Arguments[0], env)
-		if err != nil {
-			return nil
-		}
-		return n
+		return evalNewAstNode(call.Arguments[0], env)
 	}
-	// TODO: better error process during modifying
-	n := ast.Modify(quoted, f)
-	if n == nil {
-		return nil, fmt.Errorf("evalUnquote in quote err: %v", quoted.String())
+	n, err := ast.Modify(quoted, f)
+	if err != nil {
+		return nil, fmt.Errorf("evalUnquote in quote err: %w", err)
+	}
+	var stray ast.Node
+	ast.Inspect(n, func(c ast.Node) bool {
+		if stray == nil && isSplice(c) {
+			stray = c
+		}
+		return stray == nil
+	})
+	if stray != nil {
+		return nil, fmt.Errorf("%s is only allowed in an array, the arguments of a call, the parameters of a function or a block\n", stray.String())
 	}
 	return n, nil
 }
@@ -453,43 +562,13 @@ func evalNewAstNode(node ast.Node, env *object.Environment) (ast.Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	switch obj := (unquotedObj).(type) {
-	case *object.Integer:
-		return &ast.IntegerLiteral{
-			Token: token.Token{
-				Type:    token.INT,
-				Literal: fmt.Sprintf("%d", obj.Value),
-			},
-			Value: obj.Value,
-		}, nil
-	case *object.Quote:
-		return obj.Node, nil
-
-	case *object.Boolean:
-		t := token.Token{
-			Type:    token.FALSE,
-			Literal: "false",
-		}
-		if obj.Value {
-			t.Type = token.TRUE
-			t.Literal = "true"
-		}
-		return &ast.BooleanExpression{
-			Token: t,
-			Value: obj.Value,
-		}, nil
-	}
-	return nil, fmt.Errorf("TODO: cannot convert %s into ast", unquotedObj.Inspect())
+	return objectToNode(unquotedObj)
 }
 
-func evalLiteral(node ast.Node, env *object.Environment) (object.Object, error) {
-	q, err := Eval(node, env)
-	if err != nil {
-		return nil, err
-	}
-	e, ok := q.(*object.Quote)
-	if !ok {
-		return nil, fmt.Errorf("the 'eval' should be applied to a QUOTE, but got: %s", e.Inspect())
+func objectToNode(obj object.Object) (ast.Node, error) {
+	if q, ok := obj.(*object.Quote); ok {
+		// the same quote may be spliced into many places.
+		return ast.Clone(q.Node), nil
 	}
-	return Eval(e.Node, env)
+	return reify(obj)
 }
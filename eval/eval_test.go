@@ -1,6 +1,8 @@
 package eval
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -106,41 +108,56 @@ func TestHashLiteral(t *testing.T) {
 		h, ok := got.(*object.Hash)
 		assert.True(t, ok, "expected hash object, but got: %v", got.Type())
 
-		expected := map[object.HashKey]object.Object{
-			(&object.String{
-				Value: "john",
-			}).HashKey(): &object.String{
-				Value: "john smith",
-			},
-			(&object.String{
-				Value: "one",
-			}).HashKey(): &object.Integer{
-				Value: 1,
-			},
-			(&object.Boolean{
-				Value: true,
-			}).HashKey(): &object.String{
-				Value: "TRUE!!!",
-			},
-			(&object.Boolean{
-				Value: false,
-			}).HashKey(): &object.Integer{
-				Value: 100000,
-			},
-			(&object.Integer{
-				Value: 7,
-			}).HashKey(): &object.String{
-				Value: "7",
-			},
-		}
-		assert.Equal(t, len(expected), len(h.Pairs))
-		for k, v := range expected {
-			vgot, ok := h.Pairs[k]
-			assert.True(t, ok, "%v/%v not found in got", k, v.Inspect())
-			vg := vgot.Value
-			assert.Equal(t, v.Type(), vg.Type())
-			assert.Equal(t, v.Inspect(), vg.Inspect())
+		// in insertion order
+		expected := []object.HashPair{
+			{Key: &object.String{Value: "john"}, Value: &object.String{Value: "john smith"}},
+			{Key: &object.String{Value: "one"}, Value: &object.Integer{Value: 1}},
+			{Key: &object.Boolean{Value: true}, Value: &object.String{Value: "TRUE!!!"}},
+			{Key: &object.Boolean{Value: false}, Value: &object.Integer{Value: 100000}},
+			{Key: &object.Integer{Value: 7}, Value: &object.String{Value: "7"}},
 		}
+		assert.Equal(t, len(expected), h.Len())
+		for i, p := range h.Pairs() {
+			assert.Equal(t, expected[i].Key.Inspect(), p.Key.Inspect())
+			assert.Equal(t, expected[i].Value.Type(), p.Value.Type())
+			assert.Equal(t, expected[i].Value.Inspect(), p.Value.Inspect())
+		}
+		assert.Equal(t, "{john:john smith,one:1,true:TRUE!!!,false:100000,7:7}", h.Inspect())
+	}
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`[1, 2, 3, 4][1:3]`, "[2,3]", ""},
+		{`[1, 2, 3, 4][:-1]`, "[1,2,3]", ""},
+		{`[1, 2, 3, 4][-2:]`, "[3,4]", ""},
+		{`[1, 2, 3, 4][:]`, "[1,2,3,4]", ""},
+		{`[1, 2, 3, 4][2:2]`, "[]", ""},
+		{`[1, 2][0:2]`, "[1,2]", ""},
+		{`"hello"[2:]`, "llo", ""},
+		{`"hello"[:-1]`, "hell", ""},
+		{`"hello"[1:1]`, "", ""},
+		{`let a = [1, 2, 3]; let b = a[1:]; [a, b]`, "[[1,2,3],[2,3]]", ""},
+		{`[1, 2, 3][2:1]`, "", "1:10: slice bounds out of range [2:1] with length 3"},
+		{`[1, 2, 3][:4]`, "", "1:10: slice bounds out of range [0:4] with length 3"},
+		{`"abc"[-4:]`, "", "1:6: slice bounds out of range [-4:3] with length 3"},
+		{`{}[1:]`, "", "1:3: slice on HASH is not supported"},
+		{`[1][true:]`, "", "1:4: slice bound should be an INTEGER, but got BOOLEAN"},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		if !assert.Nil(t, err, "input: %v", tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
 	}
 }
 
@@ -154,7 +171,13 @@ func TestIndex(t *testing.T) {
 		{`[1,2,3][2]`, 3, nil},
 		{`1[1]`, 0, fmt.Errorf("index INTEGER on INTEGER is not supported")},
 		{`[1,2,3][true]`, 0, fmt.Errorf("index BOOLEAN on ARRAY is not supported")},
-		{`[1,2,3][3]`, 0, fmt.Errorf("out of bounds, len:3, visit:3")},
+		{`[1,2,3][3]`, 0, fmt.Errorf("1:8: index out of bounds, len:3, visit:3")},
+		{`[1,2,3][-1]`, 3, nil},
+		{`[1,2,3][-3]`, 1, nil},
+		{`[1,2,3][-4]`, 0, fmt.Errorf("1:8: index out of bounds, len:3, visit:-4")},
+		{`"abc"[1]`, "b", nil},
+		{`"abc"[-1]`, "c", nil},
+		{`"abc"[3]`, 0, fmt.Errorf("1:6: index out of bounds, len:3, visit:3")},
 		{`[1,2*3, 5+1][1]`, 6, nil},
 		{`let a = [1,2,3,4,[5,6]]; a[4][1]`, 6, nil},
 	}
@@ -258,6 +281,76 @@ func TestBuiltin(t *testing.T) {
 	}
 }
 
+func TestBuiltinContext(t *testing.T) {
+	env := object.NewEnvironment(nil)
+	var got *object.Context
+	// twice(f, x) is f(f(x))
+	env.Set("twice", &object.Builtin{Name: "twice", Fn: func(ctx *object.Context, args ...object.Object) (object.Object, error) {
+		got = ctx
+		v, err := ctx.Call(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Call(args[0], v)
+	}})
+	program, err := stringToAst("let inc = fn(x) { x + 1 };\nlet y = twice(inc, 1);\ntwice(len, y)")
+	require.Nil(t, err)
+	_, err = Eval(program, env)
+	assert.ErrorContains(t, err, "not supported on INTEGER")
+
+	_, err = Eval(program.(*ast.Program).Statements[1], env)
+	require.Nil(t, err)
+	y, err := env.Get("y")
+	require.Nil(t, err)
+	assert.Equal(t, "3", y.Inspect())
+	assert.Equal(t, "2:9", got.Pos.String())
+	assert.Equal(t, env, got.Env)
+
+	// the evaluation stops once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	env.SetContext(ctx)
+	cancel()
+	_, err = Eval(program.(*ast.Program).Statements[1], env)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.ErrorContains(t, err, "2:9: the evaluation is stopped")
+}
+
+func TestOutputBuiltins(t *testing.T) {
+	tests := []struct {
+		input  string
+		out    string
+		errOut string
+		err    string
+	}{
+		{input: `print(1, "a", [1, 2])`, out: "1 a [1,2]\n"},
+		{input: `print()`, out: ""},
+		{input: `println(); println(true)`, out: "\ntrue\n"},
+		{input: `printf("%s is %d, %v %v", "bob", 3, false, {"a": 1})`, out: "bob is 3, false {a:1}"},
+		{input: `printf("%05d|", 42); print("x")`, out: "00042|x\n"},
+		{input: `eprint("oops", 1); print("ok")`, out: "ok\n", errOut: "oops 1\n"},
+		{input: `each([1, 2], fn(x) { print(x) })`, out: "1\n2\n"},
+		{input: `eval("print(x)", {"x": 5})`, out: "5\n"},
+		{input: `printf()`, err: "wrong number of arguments, expected at least 1, but got 0"},
+		{input: `printf(1)`, err: "printf: the format should be a STRING, but got INTEGER"},
+	}
+	for _, tc := range tests {
+		program, err := stringToAst(tc.input)
+		require.Nil(t, err)
+		var out, errOut strings.Builder
+		env := object.NewEnvironment(nil)
+		env.SetOutput(&out, &errOut)
+		_, err = Eval(program, env)
+		if tc.err != "" {
+			// the whole message, which is a single line
+			assert.EqualError(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		require.Nil(t, err, "input: %v", tc.input)
+		assert.Equal(t, tc.out, out.String(), "input: %v", tc.input)
+		assert.Equal(t, tc.errOut, errOut.String(), "input: %v", tc.input)
+	}
+}
+
 func TestStringConcat(t *testing.T) {
 	type testcase struct {
 		input    string
@@ -351,6 +444,8 @@ func TestCallFunction(t *testing.T) {
 		// {"let c = 5; let add5 = fn(x, y) {return x + y + c;}; add(1,2)", 8, error},
 		{"let add = fn(x, y) {x + y;}; add(1,2)", 3, nil},
 		{"let add = fn(x, y) {x + y;}; add(1,add(2,3))", 6, nil},
+		{"let add = fn(x, y) {x + y;}; add(1, 2, 3)", 3, nil},
+		{"let add = fn(x, y) {x + y;}; add(1)", nil, fmt.Errorf("wrong number of arguments: want=2, got=1")},
 	}
 	for _, tc := range tests {
 		got, err := stringToObject(tc.input)
@@ -595,3 +690,211 @@ func testBooleanObject(t *testing.T, input string, got object.Object, expected b
 func testNull(t *testing.T, input string, got object.Object) {
 	assert.Equal(t, NULL, got, "input: %v, expected 'null', but got: %T", input, got)
 }
+
+func TestHashBuiltins(t *testing.T) {
+	type testcase struct {
+		input    string
+		expected any
+		err      error
+	}
+	tests := []testcase{
+		{`let h = {"b": 1, "a": 2, 3: true}; keys(h)`, "[b,a,3]", nil},
+		{`let h = {"b": 1, "a": 2, 3: true}; values(h)`, "[1,2,true]", nil},
+		{`let h = {"b": 1, "a": 2}; items(h)`, "[[b,1],[a,2]]", nil},
+		{`let h = {"b": 1, "a": 2}; has(h, "a")`, true, nil},
+		{`let h = {"b": 1, "a": 2}; has(h, "c")`, false, nil},
+		{`let h = {"b": 1, "a": 2, "c": 3}; delete(h, "a")`, "{b:1,c:3}", nil},
+		{`let h = {"b": 1, "a": 2}; let d = delete(h, "b"); h`, "{b:1,a:2}", nil},
+		{`merge({"b": 1, "a": 2}, {"c": 3, "b": 4})`, "{b:4,a:2,c:3}", nil},
+		{`merge()`, "{}", nil},
+		{`len({"b": 1, "a": 2})`, 2, nil},
+		{`{"x": 1, "y": 2, "x": 3}`, "{x:3,y:2}", nil},
+		{`keys([1])`, nil, fmt.Errorf("not supported on ARRAY")},
+		{`has({}, fn() {1})`, nil, fmt.Errorf("not hashable")},
+		{`merge({}, 1)`, nil, fmt.Errorf("not supported on INTEGER")},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if err != nil {
+			assert.NotNil(t, tc.err, "input: %v, actual: %v", tc.input, err)
+			require.Conditionf(t, func() bool { return strings.Contains(err.Error(), tc.err.Error()) },
+				"input: %v, expected err: %v, but got %v", tc.input, tc.err, err)
+			continue
+		}
+		assert.Nil(t, tc.err, "input: %v", tc.input)
+
+		switch v := tc.expected.(type) {
+		case int:
+			testIntegerObject(t, tc.input, got, v)
+		case bool:
+			testBooleanObject(t, tc.input, got, v)
+		case string:
+			assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+		default:
+			testNull(t, tc.input, got)
+		}
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, "a", [true]] == [1, "a", [true]]`, true},
+		{`[1, 2] == [2, 1]`, false},
+		{`[1, 2] != [1, 2, 3]`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`null == null`, true},
+		{`1 == "1"`, false},
+		{`[] != null`, true},
+		{`let f = fn() {1}; f == f`, true},
+		{`fn() {1} == fn() {1}`, false},
+		{`if ("a" == "b") { true } else { false }`, false},
+		{`let h = {[1, 2]: "array", {"k": 1}: "hash"}; h[[1, 2]] == "array"`, true},
+		{`let h = {[1, 2]: "array", {"k": 1}: "hash"}; h[{"k": 1}] == "hash"`, true},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		require.Nil(t, err, "input: %v", tc.input)
+		testBooleanObject(t, tc.input, got, tc.expected)
+	}
+
+	_, err := stringToObject(`{[1, fn() {1}]: 1}`)
+	assert.ErrorContains(t, err, "ARRAY is not hashable")
+}
+
+func TestEvalSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`eval("1 + 2")`, "3", ""},
+		{`let x = 2; eval("x * 3")`, "6", ""},
+		{`eval("let y = 5;"); y`, "5", ""},
+		{`eval("")`, "null", ""},
+		{`let f = eval("fn(a) { a + 1 }"); f(1)`, "2", ""},
+		{`eval("let m = macro(a) { quote(unquote(a) * 2) }; m(4)")`, "8", ""},
+		{`eval("x + y", {"x": 1, "y": 2})`, "3", ""},
+		{`eval("len(s)", {"s": "abc"})`, "3", ""},
+		{`let x = 1; eval("x", {})`, "", "undefined identifier: x"},
+		{`eval("let z = 1;", {}); z`, "", "undefined identifier: z"},
+		{`eval(parse("1 + 2"), {})`, "3", ""},
+		{`let q = parse("a * 2"); let a = 21; eval(q)`, "42", ""},
+		{`parse("1 + 2")`, "QUOTE((1+2))", ""},
+		{`let q = parse("1 + 2"); eval(quote(unquote(q) * 3))`, "9", ""},
+		{`eval(parse("let a = 1; a + 1"))`, "2", ""},
+		{`eval("1 +")`, "", "eval: parser error"},
+		{`parse("let = 1;")`, "", "parse: parser error"},
+		// broken code is an error of the script, it doesn't crash the interpreter
+		{`eval("[1,2][1")`, "", "eval: parser error"},
+		{`parse("a[1:")`, "", "parse: parser error"},
+		{`eval("fn() { 1")`, "", "the { of the function is not closed"},
+		{`parse(1)`, "", "parse: the code should be a STRING, but got INTEGER"},
+		{`eval(1)`, "", "the 'eval' should be applied to a QUOTE or a STRING, but got: INTEGER"},
+		{`eval("1", [])`, "", "eval: the variables should be a HASH, but got ARRAY"},
+		{`eval("1", {1: 1})`, "", "eval: the variable names should be STRINGs, but got INTEGER"},
+		{`eval()`, "", "wrong number of arguments, expected 1 or 2, but got 0"},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		require.Nil(t, err, "input: %v", tc.input)
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+}
+
+func TestDestructure(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`let [a, b] = [1, 2]; a + b`, "3", ""},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; [a, b, rest]`, "[1,2,[3,4]]", ""},
+		{`let [a, ...rest] = [1]; rest`, "[]", ""},
+		{`let [_, [b, c]] = [1, [2, 3]]; b + c`, "5", ""},
+		{`let {name, age: years} = {"name": "bob", "age": 3, "id": 7}; [name, years]`, "[bob,3]", ""},
+		{`let {"k": [x, ...xs], 1: y} = {"k": [1, 2], 1: true}; [x, xs, y]`, "[1,[2],true]", ""},
+		{`let {user: {name}} = {"user": {"name": "alice"}}; name`, "alice", ""},
+		{`let [0, x] = [0, 1]; x`, "1", ""},
+		// parameters
+		{`let f = fn([x, y], {z}) { x + y + z }; f([1, 2], {"z": 3})`, "6", ""},
+		{`let first = fn([head, ..._]) { head }; first([4, 5, 6])`, "4", ""},
+		{`let f = fn([x, y]) { x + y }; let g = parse("f"); eval(g)([1, 2])`, "3", ""},
+		// shape mismatches
+		{`let [a, b] = 1;`, "", "1:1: [a,b]: expected an ARRAY, but got INTEGER"},
+		{`let [a, b] = [1, 2, 3];`, "", "1:1: [a,b]: expected 2 elements, but got 3"},
+		{`let [a, b, ...c] = [1];`, "", "1:1: [a,b,...c]: expected at least 2 elements, but got 1"},
+		{`let {name} = [1];`, "", "1:1: {name:name}: expected a HASH, but got ARRAY"},
+		{`let {name} = {"age": 3};`, "", "1:1: {name:name}: the key name is missing in {age:3}"},
+		{`let [0, x] = [1, 2];`, "", "1:1: 0 doesn't match 1"},
+		{`let [...a, b] = [1, 2];`, "", "the rest pattern ...a should be the last one"},
+		{`let f = fn([x, y]) { x + y }; f(1)`, "", "[x,y]: expected an ARRAY, but got INTEGER"},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		if !assert.Nil(t, err, "input: %v", tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`match (0) { 0 => "zero", _ => "other" }`, "zero", ""},
+		{`match (-1) { 1 => "one", -1 => "minus one" }`, "minus one", ""},
+		{`match ("a") { "b" => 1, "a" => 2 }`, "2", ""},
+		{`match (null) { false => 1, null => 2 }`, "2", ""},
+		{`match (true) { true => 1, _ => 2 }`, "1", ""},
+		{`match (5) { n => n * 2 }`, "10", ""},
+		{`match ([]) { [first, ...rest] => first, [] => "empty" }`, "empty", ""},
+		{`match ([1, 2, 3]) { [first, ...rest] => [first, rest] }`, "[1,[2,3]]", ""},
+		{`match ([1, 2, 3]) { [a, b] => 2, [a, b, c] => a + b + c }`, "6", ""},
+		{`match ([1, [2, 3]]) { [a, [b, ..._]] => a + b }`, "3", ""},
+		{`match ([1]) { [_, ...rest] => rest }`, "[]", ""},
+		{`match ("s") { [] => 1, {} => 2, _ => 3 }`, "3", ""},
+		{`match ({"type": "user", "name": "bob", "age": 3}) { {"type": "admin"} => 1, {"type": "user", "name": n} => n }`, "bob", ""},
+		{`match ({"name": "bob"}) { {name: n} => n }`, "bob", ""},
+		{`match ({1: [2]}) { {1: [x]} => x }`, "2", ""},
+		{`match ({"a": 1}) { {"b": b} => b, _ => "no b" }`, "no b", ""},
+		// guards see the bindings of the pattern
+		{`match (5) { n if n < 3 => "small", n if n < 10 => "medium", _ => "large" }`, "medium", ""},
+		{`match ([3, 1]) { [a, b] if a < b => "sorted", [a, b] => "unsorted" }`, "unsorted", ""},
+		{`match (1) { x => { let y = x + 1; y * 2 } }`, "4", ""},
+		{`match (1) { _ => {} }`, "null", ""},
+		{`let f = fn(x) { match (x) { 0 => { return "zero"; }, _ => 1 }; "not zero" }; [f(0), f(1)]`, "[zero,not zero]", ""},
+		// the bindings are local to the arm
+		{`let n = 1; match (2) { n => n }; n`, "1", ""},
+		{`match (3) { 1 => 1, 2 => 2 }`, "", "1:1: no pattern of the match matches 3"},
+		{`match ([1]) { [a, ...r, b] => 1 }`, "", "the rest pattern ...r should be the last one"},
+		{`match (1) { a + 1 => 1 }`, "", "(a+1) is not a valid pattern"},
+		{`match ({}) { {[1]: a} => 1 }`, "", "[1] is not a valid key of a hash pattern"},
+		{`...a`, "", "...a is only allowed at the end of a pattern or the parameters of a macro"},
+	}
+	for _, tc := range tests {
+		got, err := stringToObject(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		if !assert.Nil(t, err, "input: %v", tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+}
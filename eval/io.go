@@ -0,0 +1,211 @@
+package eval
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// IOPolicy is the capability set granted to a script by its host.
+// A zero IOPolicy grants nothing, scripts are sandboxed unless the host calls EnableIO.
+type IOPolicy struct {
+	Roots    []string  // directories (and everything below them) the script may access
+	Writable bool      // whether write_file is allowed, otherwise the roots are read-only
+	Stdin    io.Reader // the source of read_stdin, nil means stdin is not readable
+}
+
+// ioBuiltins are the names of the file/stdin builtins, they are disabled by default.
+var ioBuiltins = []string{"read_file", "write_file", "read_lines", "read_stdin", "list_dir"}
+
+func ioDisabled(name string) object.BuiltinFunction {
+	return func(args ...object.Object) (object.Object, error) {
+		return nil, fmt.Errorf("%s: I/O is not enabled by the host\n", name)
+	}
+}
+
+// EnableIO binds the file/stdin builtins into env, restricted by the given policy.
+func EnableIO(env *object.Environment, policy IOPolicy) error {
+	s, err := newSandbox(policy)
+	if err != nil {
+		return err
+	}
+	fns := map[string]object.BuiltinFunction{
+		"read_file":  s.readFile,
+		"write_file": s.writeFile,
+		"read_lines": s.readLines,
+		"read_stdin": s.readStdin,
+		"list_dir":   s.listDir,
+	}
+	for _, name := range ioBuiltins {
+		if _, err := env.Set(name, &object.Builtin{Name: name, Fn: object.Simple(fns[name])}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sandbox struct {
+	roots    []string
+	writable bool
+	stdin    *bufio.Reader
+}
+
+func newSandbox(policy IOPolicy) (*sandbox, error) {
+	s := &sandbox{writable: policy.Writable}
+	for _, r := range policy.Roots {
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid io root %q: %v", r, err)
+		}
+		if abs, err = filepath.EvalSymlinks(abs); err != nil {
+			return nil, fmt.Errorf("invalid io root %q: %v", r, err)
+		}
+		s.roots = append(s.roots, abs)
+	}
+	if policy.Stdin != nil {
+		s.stdin = bufio.NewReader(policy.Stdin)
+	}
+	return s, nil
+}
+
+// resolve returns the real path of p if it is inside one of the allowed roots.
+func (s *sandbox) resolve(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	// the file itself may not exist yet (write_file), so resolve links through its directory.
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	if target, err := filepath.EvalSymlinks(resolved); err == nil {
+		resolved = target
+	} else if fi, err := os.Lstat(resolved); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		// a dangling link, writing to it would create its target wherever it is
+		return "", fmt.Errorf("access to %q is not allowed\n", p)
+	}
+	for _, root := range s.roots {
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("access to %q is not allowed\n", p)
+}
+
+func pathArg(name string, args []object.Object, n int) (string, error) {
+	if len(args) != n {
+		return "", fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", n, len(args))
+	}
+	p, ok := args[0].(*object.String)
+	if !ok {
+		return "", fmt.Errorf("%s: path should be a STRING, but got %v\n", name, args[0].Type())
+	}
+	return p.Value, nil
+}
+
+// read returns the content of the file named by the single path argument.
+func (s *sandbox) read(name string, args []object.Object) (string, error) {
+	p, err := pathArg(name, args, 1)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := s.resolve(p)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	b, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v\n", name, err)
+	}
+	return string(b), nil
+}
+
+func (s *sandbox) readFile(args ...object.Object) (object.Object, error) {
+	content, err := s.read("read_file", args)
+	if err != nil {
+		return nil, err
+	}
+	return &object.String{Value: content}, nil
+}
+
+func (s *sandbox) readLines(args ...object.Object) (object.Object, error) {
+	content, err := s.read("read_lines", args)
+	if err != nil {
+		return nil, err
+	}
+	lines := &object.Array{Elements: []object.Object{}}
+	if content == "" {
+		return lines, nil
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		lines.Elements = append(lines.Elements, &object.String{Value: strings.TrimSuffix(l, "\r")})
+	}
+	return lines, nil
+}
+
+func (s *sandbox) writeFile(args ...object.Object) (object.Object, error) {
+	p, err := pathArg("write_file", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if !s.writable {
+		return nil, fmt.Errorf("write_file: the file system is read-only\n")
+	}
+	content, ok := args[1].(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("write_file: content should be a STRING, but got %v\n", args[1].Type())
+	}
+	resolved, err := s.resolve(p)
+	if err != nil {
+		return nil, fmt.Errorf("write_file: %v", err)
+	}
+	if err := os.WriteFile(resolved, []byte(content.Value), 0o644); err != nil {
+		return nil, fmt.Errorf("write_file: %v\n", err)
+	}
+	return NULL, nil
+}
+
+func (s *sandbox) listDir(args ...object.Object) (object.Object, error) {
+	p, err := pathArg("list_dir", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := s.resolve(p)
+	if err != nil {
+		return nil, fmt.Errorf("list_dir: %v", err)
+	}
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("list_dir: %v\n", err)
+	}
+	names := &object.Array{Elements: make([]object.Object, 0, len(entries))}
+	for _, e := range entries {
+		names.Elements = append(names.Elements, &object.String{Value: e.Name()})
+	}
+	return names, nil
+}
+
+func (s *sandbox) readStdin(args ...object.Object) (object.Object, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", 0, len(args))
+	}
+	if s.stdin == nil {
+		return nil, fmt.Errorf("read_stdin: stdin is not readable\n")
+	}
+	b, err := io.ReadAll(s.stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read_stdin: %v\n", err)
+	}
+	return &object.String{Value: string(b)}, nil
+}
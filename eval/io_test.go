@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+func TestIOBuiltins(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\ntwo\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644))
+	require.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt")))
+	require.Nil(t, os.Symlink(filepath.Join(outside, "pwned.txt"), filepath.Join(root, "dangling.txt")))
+
+	type testcase struct {
+		input    string
+		policy   *IOPolicy
+		expected string
+		err      string
+	}
+	rw := &IOPolicy{Roots: []string{root}, Writable: true, Stdin: strings.NewReader("from stdin")}
+	ro := &IOPolicy{Roots: []string{root}}
+	for _, tc := range []testcase{
+		{input: `read_file("a.txt")`, err: "I/O is not enabled"},
+		{input: `read_file("a.txt")`, policy: ro, expected: "one\ntwo\n"},
+		{input: `read_lines("a.txt")`, policy: ro, expected: "[one,two]"},
+		{input: `list_dir(".")`, policy: ro, expected: "[a.txt,dangling.txt,link.txt]"},
+		{input: `read_file("../` + filepath.Base(outside) + `/secret.txt")`, policy: ro, err: "is not allowed"},
+		{input: `read_file("link.txt")`, policy: ro, err: "is not allowed"},
+		{input: `write_file("b.txt", "hi")`, policy: ro, err: "read-only"},
+		{input: `read_stdin()`, policy: ro, err: "stdin is not readable"},
+		{input: `write_file("b.txt", "hi"); read_file("b.txt")`, policy: rw, expected: "hi"},
+		{input: `read_stdin()`, policy: rw, expected: "from stdin"},
+		{input: `write_file("dangling.txt", "x")`, policy: rw, err: "is not allowed"},
+		{input: `read_file("dangling.txt")`, policy: rw, err: "is not allowed"},
+	} {
+		got, err := evalWithIO(t, root, tc.input, tc.policy)
+		if tc.err != "" {
+			require.NotNil(t, err, "input: %v", tc.input)
+			assert.Contains(t, err.Error(), tc.err, "input: %v", tc.input)
+			continue
+		}
+		require.Nil(t, err, "input: %v", tc.input)
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+	assert.NoFileExists(t, filepath.Join(outside, "pwned.txt"))
+}
+
+func evalWithIO(t *testing.T, dir string, input string, policy *IOPolicy) (object.Object, error) {
+	wd, err := os.Getwd()
+	require.Nil(t, err)
+	require.Nil(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	program, err := stringToAst(input)
+	require.Nil(t, err)
+	env := object.NewEnvironment(nil)
+	if policy != nil {
+		require.Nil(t, EnableIO(env, *policy))
+	}
+	return Eval(program, env)
+}
@@ -1,15 +1,21 @@
 package eval
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"slices"
+	"strings"
+	"sync/atomic"
 
 	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/format"
 	"github.com/ChaosNyaruko/monkey/object"
+	"github.com/ChaosNyaruko/monkey/token"
 )
 
-// DefineMacros walks through the program ast, extract all macro(s) into env, and remove them from the ast.
-// For simplicity, we only allow to define macro at the top layer of the progrom.
+// DefineMacros walks through the program ast, extract all macro(s) at the top layer into env, and remove them from the ast.
+// The macros in nested blocks and the imported ones are defined by ExpandMacros.
 func DefineMacros(p *ast.Program, env *object.Environment) error {
 	removed := []int{}
 	// extract all the defined macros
@@ -39,12 +45,17 @@ func addMacro(node ast.Statement, env *object.Environment) error {
 		return fmt.Errorf("should be assigned with a macro, but got: %T", let.Value)
 	}
 
+	params, rest, err := macroParameters(v.Parameters)
+	if err != nil {
+		return err
+	}
 	macro := &object.Macro{
-		Parameters: v.Parameters,
+		Parameters: params,
+		Rest:       rest,
 		Body:       v.Body,
 		Env:        env,
 	}
-	_, err := env.Set(let.Name.String(), macro)
+	_, err = env.Set(let.Name.String(), macro)
 	return err
 }
 
@@ -53,6 +64,9 @@ func isMacroDef(node ast.Statement) bool {
 	if !ok {
 		return false
 	}
+	if _, ok := let.Name.(*ast.Identifier); !ok {
+		return false
+	}
 	_, ok = let.Value.(*ast.MacroLiteral)
 	if !ok {
 		return false
@@ -80,39 +94,406 @@ func isMacroCall(node *ast.CallExpression, env *object.Environment) (*object.Mac
 }
 
 // ExpandMacros reads the macro literal by name in the environment, and "expand" it into a real AST(before evaluation).
-func ExpandMacros(p *ast.Program, env *object.Environment) ast.Node {
-	f := func(node ast.Node) ast.Node {
+func ExpandMacros(p *ast.Program, env *object.Environment) (ast.Node, error) {
+	return (&Expander{}).Expand(p, env)
+}
+
+// DefaultMaxDepth is the default maximum nesting depth of the macro expansions.
+const DefaultMaxDepth = 100
+
+// Expander expands the macro calls of a program, the zero value is ready to use.
+type Expander struct {
+	// OnExpand, if set, is called after a macro call is replaced by the expanded node.
+	OnExpand func(call *ast.CallExpression, expanded ast.Node)
+	// Import returns the program of the module imported by import_macros(path), nil disables importing.
+	// The relative paths imported by a module are joined to its directory, e.g. b.mk imported by lib/a.mk is lib/b.mk.
+	Import func(path string) (*ast.Program, error)
+	// Trace, if set, is where every expansion step is printed, the nested ones are indented, e.g.
+	//
+	//	1:1: reverse_sub(1, 2) -> 2 - 1
+	Trace io.Writer
+	// MaxDepth is the maximum nesting depth of the expansions, an expanded node is expanded again
+	// if it has macro calls. DefaultMaxDepth is used if it's not positive.
+	MaxDepth int
+
+	importing []string                                      // the modules being imported, to report the import cycles
+	exports   []*ast.Identifier                             // the macros exported by the program
+	scopes    map[ast.Node]*object.Environment              // the macros visible to the calls
+	stack     []*ast.CallExpression                         // the calls being expanded, the outermost first
+	path      []ast.Node                                    // the ancestors of the node being resolved
+	outer     map[*ast.CallExpression][]*ast.CallExpression // the calls whose arguments contain the call, the outermost first
+}
+
+// MacroError is returned when a macro call can't be expanded.
+type MacroError struct {
+	Name string         // the name of the macro
+	Pos  token.Position // where it's called
+	// Backtrace is the expansions in progress, the innermost first, e.g. "in the arguments of outer at 1:1".
+	Backtrace []string
+	Err       error
+}
+
+func (e *MacroError) Error() string {
+	var out bytes.Buffer
+	// the errors of the evaluation may end with a newline
+	fmt.Fprintf(&out, "%s: expand macro %s: %s", e.Pos, e.Name, strings.TrimSuffix(e.Err.Error(), "\n"))
+	// a recursive macro repeats the same lines
+	for i := 0; i < len(e.Backtrace); {
+		n := 1
+		for i+n < len(e.Backtrace) && e.Backtrace[i+n] == e.Backtrace[i] {
+			n++
+		}
+		out.WriteString("\n\t" + e.Backtrace[i])
+		if n > 1 {
+			fmt.Fprintf(&out, " (%d times)", n)
+		}
+		i += n
+	}
+	return out.String()
+}
+
+func (e *MacroError) Unwrap() error {
+	return e.Err
+}
+
+// Expand defines the macros of p and replaces the macro calls in it.
+// The macros defined at the top level and the imported ones are bound in env, the macros defined in a block,
+// e.g. a function body, are only visible inside the block.
+func (x *Expander) Expand(p *ast.Program, env *object.Environment) (ast.Node, error) {
+	x.scopes = map[ast.Node]*object.Environment{}
+	x.outer = map[*ast.CallExpression][]*ast.CallExpression{}
+	x.path, x.stack = nil, nil
+	var err error
+	if p.Statements, err = x.define(p.Statements, env, true); err != nil {
+		return nil, err
+	}
+	for _, s := range p.Statements {
+		if err := x.resolve(s, env, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return x.expandCalls(p, env)
+}
+
+// expandCalls replaces the macro calls in node, the expanded nodes are expanded again until no macro calls remain.
+func (x *Expander) expandCalls(node ast.Node, env *object.Environment) (ast.Node, error) {
+	return ast.Modify(node, func(node ast.Node) (ast.Node, error) {
 		call, ok := node.(*ast.CallExpression)
 		if !ok {
-			return node
+			return node, nil
 		}
-		m, ok := isMacroCall(call, env)
+		scope := x.scope(call, env)
+		m, ok := isMacroCall(call, scope)
 		if !ok {
-			return node
-		}
-		newEnv := object.NewEnvironment(env)
-		// log.Printf("expand %v", m.Inspect())
-		// process args list
-		// pass the "quoted" ast, to make the args not be evaluated before body evaluation.
-		for i, a := range call.Arguments {
-			qa := &object.Quote{Node: a}
-			// log.Printf("qa: %s", a)
-			// ea, _ := Eval(a, env)
-			// store the args into env(for the individual macro call)
-			newEnv.Set(m.Parameters[i].Value, qa)
-		}
-		// process body
-		// log.Println(fmt.Sprintf("before expandedNode: %s", m.Body.String()))
-		expandedNode, err := Eval(m.Body, newEnv)
-		// log.Println(fmt.Sprintf("after expandedNode: %s, %s", expandedNode.Type(), expandedNode.Inspect()))
+			return node, nil
+		}
+		if len(x.stack) >= x.maxDepth() {
+			return nil, x.error(call, env, fmt.Errorf("the expansion is deeper than %d levels, the macro may expand to itself endlessly", x.maxDepth()))
+		}
+		expanded, err := x.expand(call, m)
 		if err != nil {
-			return node
+			return nil, x.error(call, env, err)
+		}
+		if x.Trace != nil {
+			fmt.Fprintf(x.Trace, "%s%s: %s -> %s\n", strings.Repeat("  ", len(x.stack)), callPos(call), format.Node(call), format.Node(expanded))
 		}
-		quote, ok := expandedNode.(*object.Quote)
+		if x.OnExpand != nil {
+			x.OnExpand(call, expanded)
+		}
+
+		x.stack = append(x.stack, call)
+		defer func() { x.stack = x.stack[:len(x.stack)-1] }()
+		if err := x.resolve(expanded, expansionScope(expanded, scope, m.Env), false); err != nil {
+			return nil, x.error(call, env, err)
+		}
+		return x.expandCalls(expanded, env)
+	})
+}
+
+// expansionScope returns the scope of the macro calls in the code expanded by a macro defined in def.
+// The macros are looked up in def first, e.g. the helpers which are not exported by the module of the macro,
+// and then in the scope of the call, e.g. for the macro calls in the arguments.
+func expansionScope(expanded ast.Node, scope, def *object.Environment) *object.Environment {
+	res := object.NewEnvironment(scope)
+	ast.Inspect(expanded, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok {
+			if m, ok := isMacroCall(call, def); ok {
+				res.Set(call.F.String(), m)
+			}
+		}
+		return true
+	})
+	return res
+}
+
+func (x *Expander) maxDepth() int {
+	if x.MaxDepth > 0 {
+		return x.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// scope returns the environment of the macros visible to the call.
+func (x *Expander) scope(call *ast.CallExpression, env *object.Environment) *object.Environment {
+	if scope, ok := x.scopes[call]; ok {
+		return scope
+	}
+	return env
+}
+
+// expand evaluates the macro body with the quoted arguments.
+func (x *Expander) expand(call *ast.CallExpression, m *object.Macro) (ast.Node, error) {
+	if m.Rest == nil && len(call.Arguments) != len(m.Parameters) {
+		return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", len(m.Parameters), len(call.Arguments))
+	}
+	if m.Rest != nil && len(call.Arguments) < len(m.Parameters) {
+		return nil, fmt.Errorf("wrong number of arguments: want>=%d, got=%d", len(m.Parameters), len(call.Arguments))
+	}
+	newEnv := object.NewEnvironment(m.Env)
+	// pass the "quoted" ast, to make the args not be evaluated before body evaluation.
+	for i, p := range m.Parameters {
+		newEnv.Set(p.Value, &object.Quote{Node: call.Arguments[i]})
+	}
+	if m.Rest != nil {
+		// the rest arguments are an array of quotes, e.g. to be spliced by unquote_splice.
+		rest := &object.Array{Elements: []object.Object{}}
+		for _, a := range call.Arguments[len(m.Parameters):] {
+			rest.Elements = append(rest.Elements, &object.Quote{Node: a})
+		}
+		newEnv.Set(m.Rest.Value, rest)
+	}
+	res, err := Eval(hygiene(m.Body), newEnv)
+	if err != nil {
+		return nil, err
+	}
+	if ret, ok := res.(*object.ReturnValue); ok {
+		res = ret.Value
+	}
+	quote, ok := res.(*object.Quote)
+	if !ok {
+		return nil, fmt.Errorf("macros should only return QUOTEs(AST-nodes), but got %s", res.Type())
+	}
+	return quote.Node, nil
+}
+
+// error wraps the error of expanding the call with the backtrace: the macros whose arguments contain the call,
+// and the expansions which the call comes from.
+func (x *Expander) error(call *ast.CallExpression, env *object.Environment, err error) error {
+	e := &MacroError{Name: call.F.String(), Pos: callPos(call), Err: err}
+	outer := x.outer[call]
+	for i := len(outer) - 1; i >= 0; i-- {
+		if _, ok := isMacroCall(outer[i], x.scope(outer[i], env)); ok {
+			e.Backtrace = append(e.Backtrace, fmt.Sprintf("in the arguments of %s at %s", outer[i].F, callPos(outer[i])))
+		}
+	}
+	for i := len(x.stack) - 1; i >= 0; i-- {
+		e.Backtrace = append(e.Backtrace, fmt.Sprintf("in the expansion of %s at %s", x.stack[i].F, callPos(x.stack[i])))
+	}
+	return e
+}
+
+// callPos is the position of the name of the function or the macro of a call.
+func callPos(call *ast.CallExpression) token.Position {
+	if id, ok := call.F.(*ast.Identifier); ok {
+		return id.Token.Pos
+	}
+	return call.Token.Pos
+}
+
+// define binds the macros defined by the statements in env, and returns the other statements.
+// At the top level, the macros are imported and exported too.
+func (x *Expander) define(stmts []ast.Statement, env *object.Environment, top bool) ([]ast.Statement, error) {
+	res := make([]ast.Statement, 0, len(stmts))
+	for _, s := range stmts {
+		if isMacroDef(s) {
+			if err := addMacro(s, env); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		call, ok := moduleDirective(s)
 		if !ok {
-			panic("macros should only return QUOTEs(AST-nodes)")
+			res = append(res, s)
+			continue
+		}
+		if !top {
+			return nil, fmt.Errorf("%s: %s is only allowed at the top level of a program", directivePos(call), call.F)
+		}
+		if err := x.module(call, env); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// resolve records the macros visible to the calls in node, defining the macros in the nested blocks.
+// A macro literal anywhere else than a let statement in a program or a block is an error, unless it's quoted.
+func (x *Expander) resolve(node ast.Node, env *object.Environment, quoted bool) error {
+	var err error
+	ast.Inspect(node, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		if n == nil {
+			x.path = x.path[:len(x.path)-1]
+			return false
+		}
+		// children reports whether to visit the children of n, after the ancestors of them are recorded.
+		children := func() bool {
+			x.path = append(x.path, n)
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.BlockStatement:
+			if quoted || !slices.ContainsFunc(n.Statements, isMacroDef) {
+				return children()
+			}
+			scope := object.NewEnvironment(env)
+			if n.Statements, err = x.define(n.Statements, scope, false); err != nil {
+				return false
+			}
+			err = resolveChildren(x, n, n.Statements, func(s ast.Statement) error { return x.resolve(s, scope, quoted) })
+			return false
+		case *ast.CallExpression:
+			x.scopes[n] = env
+			for _, a := range x.path {
+				if c, ok := a.(*ast.CallExpression); ok {
+					x.outer[n] = append(x.outer[n], c)
+				}
+			}
+			if n.F.TokenLiteral() == "quote" && !quoted {
+				err = resolveChildren(x, n, n.Arguments, func(a ast.Expression) error { return x.resolve(a, env, true) })
+				return false
+			}
+		case *ast.MacroLiteral:
+			if !quoted {
+				err = fmt.Errorf("%s: a macro can only be defined by a let statement in a program or a block, e.g. let m = macro(x) { x };", n.Token.Pos)
+			}
+			return false
+		case *ast.ExpressionStatement:
+			if call, ok := moduleDirective(n); ok && !quoted {
+				err = fmt.Errorf("%s: %s is only allowed at the top level of a program", directivePos(call), call.F)
+				return false
+			}
+		}
+		return children()
+	})
+	return err
+}
+
+// resolveChildren resolves the children of parent one by one.
+func resolveChildren[T ast.Node](x *Expander, parent ast.Node, children []T, resolve func(T) error) error {
+	x.path = append(x.path, parent)
+	defer func() { x.path = x.path[:len(x.path)-1] }()
+	for _, c := range children {
+		if err := resolve(c); err != nil {
+			return err
 		}
-		return quote.Node
 	}
-	return ast.Modify(p, f)
+	return nil
+}
+
+// gensyms is the number of the names generated by gensym, the generated names are unique in the process,
+// since the expanded code of different programs may run in the same environment, e.g. in the REPL.
+var gensyms atomic.Int64
+
+// gensym returns a fresh name for name, e.g. tmp__1, which never clashes with the names written in a program,
+// since an identifier can't have digits.
+func gensym(name string) string {
+	return fmt.Sprintf("%s__%d", name, gensyms.Add(1))
+}
+
+// hygiene returns a copy of the macro body, in which the names bound by the quoted code, i.e. by let statements,
+// function parameters and the patterns of match, are renamed with gensym, so that the expanded code can neither
+// clobber nor capture the variables at the call site. The unquoted parts are not renamed, they are the arguments
+// or computed by the macro.
+func hygiene(body *ast.BlockStatement) *ast.BlockStatement {
+	body = ast.Clone(body).(*ast.BlockStatement)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok || call.F.TokenLiteral() != "quote" {
+			return true
+		}
+		for _, a := range call.Arguments {
+			renameBindings(a, nil)
+		}
+		return false
+	})
+	return body
+}
+
+// renameBindings renames the names of the quoted code bound in it within their scopes: the rest of the block
+// for a let, the parameters and the body for a function, the guard and the body for an arm of a match.
+// names maps the names bound by the enclosing scopes to their new names.
+func renameBindings(quoted ast.Node, names map[string]string) {
+	ast.Inspect(quoted, func(n ast.Node) bool {
+		if _, ok := unquoted(n); n == nil || ok {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if name, ok := names[n.Value]; ok {
+				rename(n, name)
+			}
+		case *ast.BlockStatement:
+			scope := names
+			for _, s := range n.Statements {
+				let, ok := s.(*ast.LetStatement)
+				if !ok {
+					renameBindings(s, scope)
+					continue
+				}
+				inner := bindPattern(let.Name, scope)
+				// the value sees the new name only if it's a function, e.g. a recursive one
+				if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+					renameBindings(let.Value, inner)
+				} else {
+					renameBindings(let.Value, scope)
+				}
+				scope = inner
+			}
+			return false
+		case *ast.FunctionLiteral:
+			scope := names
+			for _, p := range n.Parameters {
+				scope = bindPattern(p, scope)
+			}
+			renameBindings(n.Body, scope)
+			return false
+		case *ast.MatchExpression:
+			renameBindings(n.Value, names)
+			for _, a := range n.Arms {
+				scope := bindPattern(a.Pattern, names)
+				if a.Guard != nil {
+					renameBindings(a.Guard, scope)
+				}
+				renameBindings(a.Body, scope)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// bindPattern renames the names bound by the pattern, and returns names with the new ones.
+func bindPattern(pattern ast.Expression, names map[string]string) map[string]string {
+	ids, _ := patternNames(pattern)
+	if len(ids) == 0 {
+		return names
+	}
+	scope := make(map[string]string, len(names)+len(ids))
+	for k, v := range names {
+		scope[k] = v
+	}
+	for _, id := range ids {
+		scope[id.Value] = gensym(id.Value)
+		rename(id, scope[id.Value])
+	}
+	return scope
+}
+
+func rename(id *ast.Identifier, name string) {
+	id.Value = name
+	id.Token.Literal = name
 }
@@ -1,13 +1,20 @@
 package eval
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/format"
 	"github.com/ChaosNyaruko/monkey/lexer"
 	"github.com/ChaosNyaruko/monkey/object"
 	"github.com/ChaosNyaruko/monkey/parser"
+	"github.com/ChaosNyaruko/monkey/token"
 )
 
 func TestDefine(t *testing.T) {
@@ -63,6 +70,18 @@ func TestExpand(t *testing.T) {
 `,
 			`(1+2)`,
 		},
+		{
+			`let reverse_sub = macro(a, b) {quote(unquote(b) - unquote(a))};
+			  print([reverse_sub(1, 2)]);
+			`,
+			`print([(2-1)])`,
+		},
+		{
+			`let id = macro(a) {quote(unquote(a))};
+			  let f = fn() { id(id(1)) };
+			`,
+			`let f = fn()1;`,
+		},
 	} {
 		env := object.NewEnvironment(nil)
 		l := lexer.New(tc.input)
@@ -71,9 +90,694 @@ func TestExpand(t *testing.T) {
 
 		err := DefineMacros(program, env)
 		assert.Nil(t, err)
-		res := ExpandMacros(program, env)
+		res, err := ExpandMacros(program, env)
 		assert.Nil(t, err)
 
 		assert.Equal(t, tc.expected, res.String())
 	}
 }
+
+func TestExpandError(t *testing.T) {
+	input := `let m = macro(a) { let f = fn() { f }; quote(unquote(f)) }; m(1)`
+	env := object.NewEnvironment(nil)
+	program, err := stringToAst(input)
+	assert.Nil(t, err)
+	assert.Nil(t, DefineMacros(program.(*ast.Program), env))
+
+	_, err = ExpandMacros(program.(*ast.Program), env)
+	assert.ErrorContains(t, err, "expand macro m")
+	assert.ErrorContains(t, err, "cannot convert")
+}
+
+func TestMacroError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let m = macro(a, b) { quote(1) };\nm(1)", "2:1: expand macro m: wrong number of arguments: want=2, got=1"},
+		{"let m = macro(a) { quote(1) };\nm(1, 2)", "2:1: expand macro m: wrong number of arguments: want=1, got=2"},
+		{"let m = macro(a) { 1 };\nm(1)", "2:1: expand macro m: macros should only return QUOTEs(AST-nodes), but got INTEGER"},
+		{"let m = macro() { x };\nm()", "2:1: expand macro m: undefined identifier: x"},
+		// the backtrace tells which macros the call is nested in
+		{
+			"let m = macro(a) { a };\nlet bad = macro() { 1 };\nm(f(m(bad())))",
+			"3:7: expand macro bad: macros should only return QUOTEs(AST-nodes), but got INTEGER\n\tin the arguments of m at 3:5\n\tin the arguments of m at 3:1",
+		},
+	}
+	for _, tc := range tests {
+		_, err := expandAndEval(&Expander{}, tc.input)
+		var e *MacroError
+		if assert.ErrorAs(t, err, &e, tc.input) {
+			assert.Equal(t, tc.expected, e.Error(), tc.input)
+		}
+	}
+
+	// a macro body may return the quote explicitly
+	res, err := expandAndEval(&Expander{}, `let m = macro(a) { return quote(unquote(a) + 1); }; m(1)`)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", res.Inspect())
+}
+
+func TestExpandTrace(t *testing.T) {
+	var out bytes.Buffer
+	_, err := expandAndEval(&Expander{Trace: &out}, `
+let reverse_sub = macro(a, b) { quote(unquote(b) - unquote(a)) };
+let twice = macro(a) { quote(unquote(a) * 2) };
+twice(reverse_sub(1, 2));
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "4:7: reverse_sub(1, 2) -> 2 - 1\n4:1: twice(2 - 1) -> (2 - 1) * 2\n", out.String())
+}
+
+func TestExpandTwice(t *testing.T) {
+	input := `
+	let double = macro(a) { quote(unquote(a) + unquote(a)) };
+	let reverse_sub = macro(a, b) { quote(unquote(b) - unquote(a)) };
+	print(reverse_sub(1, 2), reverse_sub(3, 4));
+	double(x);
+`
+	env := object.NewEnvironment(nil)
+	program, err := stringToAst(input)
+	assert.Nil(t, err)
+	assert.Nil(t, DefineMacros(program.(*ast.Program), env))
+	res, err := ExpandMacros(program.(*ast.Program), env)
+	assert.Nil(t, err)
+
+	expected, err := stringToAst(`print(2 - 1, 4 - 3); x + x;`)
+	assert.Nil(t, err)
+	assert.True(t, ast.Equal(expected, res), "got: %s", res)
+
+	// the spliced arguments are not shared
+	sum := res.(*ast.Program).Statements[1].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	assert.NotSame(t, sum.Lhs, sum.Rhs)
+}
+
+func TestQuoteTwice(t *testing.T) {
+	got, err := stringToObject(`
+	let q = fn(x) { quote(unquote(x) + 1) };
+	let a = q(1);
+	let b = q(2);
+	[a, b]
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "[QUOTE((1+1)),QUOTE((2+1))]", got.Inspect())
+}
+
+func TestUnquoteObjects(t *testing.T) {
+	tests := []struct {
+		input    string // evaluated to an object, which is unquoted
+		expected string // the formatted code of the quote
+	}{
+		{`1`, `1`},
+		{`true`, `true`},
+		{`"hello world"`, `"hello world"`},
+		{`null`, `null`},
+		{`[1, "two", [null, false]]`, `[1, "two", [null, false]]`},
+		{`{"b": 1, "a": [2], true: {}}`, `{"b": 1, "a": [2], true: {}}`},
+		{`[quote(a + b)]`, `[quote(a + b)]`},
+		{`len`, `len`},
+		{`fn(x) { x * 2 }`, `fn(x) { x * 2 }`},
+		{`let add = fn(x) { fn(y) { x + y } }; add(1)`, "fn(y) {\n\tlet x = 1;\n\tx + y\n}"},
+		{`let k = [1]; let f = fn(x) { let g = fn(k) { k }; g(x) + k[0] + len(k) }; f`, "fn(x) {\n\tlet k = [1];\n\tlet g = fn(k) { k };\n\tg(x) + k[0] + len(k)\n}"},
+	}
+	for _, tc := range tests {
+		env := object.NewEnvironment(nil)
+		program, err := stringToAst(tc.input)
+		assert.Nil(t, err)
+		value, err := Eval(program, env)
+		assert.Nil(t, err, tc.input)
+		_, err = env.Set("v", value)
+		assert.Nil(t, err)
+
+		unquote, err := stringToAst(`quote(unquote(v))`)
+		assert.Nil(t, err)
+		q, err := Eval(unquote, env)
+		if !assert.Nil(t, err, tc.input) {
+			continue
+		}
+		node := q.(*object.Quote).Node
+		assert.Equal(t, tc.expected, format.Node(node), tc.input)
+
+		// the code evaluates to an equal object, in a fresh environment
+		if _, ok := value.(*object.Function); ok {
+			continue
+		}
+		res, err := Eval(node, object.NewEnvironment(nil))
+		assert.Nil(t, err, tc.input)
+		assert.Equal(t, value.Inspect(), res.Inspect(), tc.input)
+	}
+
+	// the captured variables are converted too
+	res, err := stringToObject(`let add = fn(x) { fn(y) { x + y } }; let inc = add(1); eval(quote(unquote(inc)(2)))`)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", res.Inspect())
+
+	_, err = stringToObject(`let f = fn() { f }; quote(unquote(f))`)
+	assert.ErrorContains(t, err, "cannot convert a recursive function")
+	_, err = stringToObject(`let g = fn() { g }; let f = fn() { g }; quote(unquote(f))`)
+	assert.ErrorContains(t, err, "cannot convert the captured g: cannot convert a recursive function")
+}
+
+func TestUnquoteSplice(t *testing.T) {
+	tests := []struct {
+		input    string // the last expression is a quote
+		expected string // the formatted code of the quote
+	}{
+		{`let xs = [1, 2]; quote([0, unquote_splice(xs), 3])`, `[0, 1, 2, 3]`},
+		{`quote([unquote_splice([])])`, `[]`},
+		{`let args = [quote(a + 1), "s"]; quote(f(unquote_splice(args)))`, `f(a + 1, "s")`},
+		{`let ps = [quote(a), "b"]; quote(fn(x, unquote_splice(ps)) { a + b })`, `fn(x, a, b) { a + b }`},
+		{`quote(macro(unquote_splice(["a"])) { a })`, `macro(a) { a }`},
+		{
+			`let lets = [parse("let a = 1;"), parse("let b = 2; let c = 3;"), quote(a)]; quote(fn() { unquote_splice(lets); b })`,
+			"fn() {\n\tlet a = 1;\n\tlet b = 2;\n\tlet c = 3;\n\ta;\n\tb\n}",
+		},
+	}
+	for _, tc := range tests {
+		q, err := stringToObject(tc.input)
+		if !assert.Nil(t, err, tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, format.Node(q.(*object.Quote).Node), tc.input)
+	}
+
+	// a macro building a call with a variable number of arguments
+	res, err := expandAndEval(&Expander{}, `
+	let sum = fn(a, b, c) { a + b + c };
+	let thrice = macro(f, x) { let args = [x, x, x]; quote(unquote(f)(unquote_splice(args))) };
+	thrice(sum, 2)
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "6", res.Inspect())
+
+	errs := []struct {
+		input string
+		err   string
+	}{
+		{`quote(f(unquote_splice(1)))`, "unquote_splice should be applied to an ARRAY, but got INTEGER"},
+		{`quote(1 + unquote_splice([1]))`, "unquote_splice([1]) is only allowed in an array, the arguments of a call, the parameters of a function or a block"},
+		{`quote(fn(unquote_splice([1])) { 1 })`, "unquote_splice: 1 is not a parameter name"},
+		{`quote(f(unquote_splice([parse("let a = 1;")])))`, "is not an expression"},
+		{`fn(unquote_splice(ps)) { 1 }`, "unquote_splice(ps) can only be used as a parameter in quote"},
+	}
+	for _, tc := range errs {
+		_, err := stringToObject(tc.input)
+		assert.ErrorContains(t, err, tc.err, tc.input)
+	}
+}
+
+func TestExpandVariadic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let count = macro(...args) { let n = len(args); quote(unquote(n)) }; [count(), count(a, b + c)]`, "[0,2]"},
+		{`let second = macro(a, ...rest) { first(rest) }; second(1, 2, 3)`, "2"},
+		{`let list = macro(head, ...tail) { quote([unquote(head), unquote_splice(tail)]) }; list(1, 2 + 3)`, "[1,5]"},
+		{`let do = macro(...stmts) { quote(fn() { unquote_splice(stmts) }()) }; do(1, 2, 3)`, "3"},
+		// expanded recursively, the rest arguments are passed on by unquote_splice
+		{`
+		let cond = macro(c, v, ...rest) {
+			if (len(rest) == 0) {
+				quote(if (unquote(c)) { unquote(v) })
+			} else {
+				quote(if (unquote(c)) { unquote(v) } else { cond(unquote_splice(rest)) })
+			}
+		};
+		let x = 5;
+		[cond(x < 3, "small", x < 10, "medium", true, "large"), cond(x > 10, "large")]
+		`, "[medium,null]"},
+	}
+	for _, tc := range tests {
+		res, err := expandAndEval(&Expander{}, tc.input)
+		if !assert.Nil(t, err, tc.input) {
+			continue
+		}
+		assert.Equal(t, tc.expected, res.Inspect(), tc.input)
+	}
+
+	errs := []struct {
+		input string
+		err   string
+	}{
+		{`let m = macro(a, b) { a }; m(1)`, "wrong number of arguments: want=2, got=1"},
+		{`let m = macro(a) { a }; m(1, 2)`, "wrong number of arguments: want=1, got=2"},
+		{`let m = macro(a, b, ...c) { a }; m(1)`, "wrong number of arguments: want>=2, got=1"},
+		{`let f = fn(a, ...b) { a }; f(1)`, "...b: only macros can have a rest parameter"},
+		{`let m = macro([a]) { a }; m(1)`, "[a]: a macro parameter can't be a pattern"},
+	}
+	for _, tc := range errs {
+		_, err := expandAndEval(&Expander{}, tc.input)
+		assert.ErrorContains(t, err, tc.err, tc.input)
+	}
+}
+
+func TestExpanderOnExpand(t *testing.T) {
+	input := `
+	let double = macro(a) { quote(unquote(a) + unquote(a)) };
+	let x = double(double(1));
+	print(x);
+`
+	env := object.NewEnvironment(nil)
+	program, err := stringToAst(input)
+	assert.Nil(t, err)
+	assert.Nil(t, DefineMacros(program.(*ast.Program), env))
+
+	var steps []string
+	x := &Expander{
+		OnExpand: func(call *ast.CallExpression, expanded ast.Node) {
+			steps = append(steps, call.String()+" -> "+expanded.String())
+		},
+	}
+	_, err = x.Expand(program.(*ast.Program), env)
+	assert.Nil(t, err)
+	// the inner call is expanded first
+	assert.Equal(t, []string{"double(1) -> (1+1)", "double((1+1)) -> ((1+1)+(1+1))"}, steps)
+}
+
+func TestExpandHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// the let in the macro doesn't clobber the caller's tmp
+		{`
+	let square = macro(x) { quote(if (true) { let tmp = unquote(x); tmp * tmp }) };
+	let tmp = 3;
+	[square(tmp + 1), tmp]
+`, "[16,3]"},
+		// the parameter of the macro's function doesn't capture the caller's y
+		{`
+	let with_y = macro(e) { quote(fn(y) { unquote(e) }(100)) };
+	let y = 1;
+	with_y(y + 1)
+`, "2"},
+		// the names in the unquoted arguments are kept
+		{`
+	let bind = macro(v, body) { quote(fn(it) { unquote(body) }(unquote(v))) };
+	let it = 10;
+	bind(1, it)
+`, "10"},
+		// the names bound by the patterns of a match are renamed, but not the names of the keys
+		{`
+	let name_or = macro(h, e) { quote(match (unquote(h)) { {name: name} => name, _ => unquote(e) }) };
+	let name = "caller";
+	[name_or({"name": "bob"}, name), name_or({}, name)]
+`, "[bob,caller]"},
+		// so are the names bound by the patterns of a let or a parameter
+		{`
+	let swap = macro(p) { quote(fn() { let [a, b] = unquote(p); let f = fn({a}) { a }; [b, f({"a": a})] }()) };
+	let a = 1;
+	let b = 2;
+	swap([a, b])
+`, "[2,1]"},
+		// a name is only renamed in the scope of its binding, the free x is the caller's one
+		{`
+	let x = 10;
+	let m = macro(a) { quote(fn(x) { x * 2 }(unquote(a)) + x) };
+	m(1)
+`, "12"},
+		{`
+	let x = 5;
+	let m = macro() { quote([if (true) { let x = 1; x }, x]) };
+	m()
+`, "[1,5]"},
+		// the value of a let sees the caller's name, unless it's a function, e.g. a recursive one
+		{`
+	let x = 2;
+	let m = macro() { quote(if (true) { let x = x * 3; x }) };
+	m()
+`, "6"},
+		{`
+	let sum = macro(n) { quote(fn() { let f = fn(k) { if (k == 0) { 0 } else { k + f(k - 1) } }; f(unquote(n)) }()) };
+	let f = 0;
+	[sum(3), f]
+`, "[6,0]"},
+	}
+	for _, tc := range tests {
+		env := object.NewEnvironment(nil)
+		program, err := stringToAst(tc.input)
+		assert.Nil(t, err)
+		assert.Nil(t, DefineMacros(program.(*ast.Program), env))
+		expanded, err := ExpandMacros(program.(*ast.Program), env)
+		assert.Nil(t, err)
+		res, err := Eval(expanded, env)
+		assert.Nil(t, err, tc.input)
+		assert.Equal(t, tc.expected, res.Inspect(), tc.input)
+	}
+}
+
+func TestExpandHygieneNames(t *testing.T) {
+	env := object.NewEnvironment(nil)
+	program, err := stringToAst(`
+	let m = macro(x) { quote(fn(tmp) { let y = tmp; y + unquote(x) }) };
+	m(y);
+	m(y);
+`)
+	assert.Nil(t, err)
+	assert.Nil(t, DefineMacros(program.(*ast.Program), env))
+	res, err := ExpandMacros(program.(*ast.Program), env)
+	assert.Nil(t, err)
+
+	stmts := res.(*ast.Program).Statements
+	first := stmts[0].String()
+	assert.Regexp(t, `^fn\(tmp__\d+\)let y__\d+ = tmp__\d+;\(y__\d+\+y\)$`, first)
+	// every expansion gets its own names
+	assert.NotEqual(t, first, stmts[1].String())
+}
+
+func TestGensym(t *testing.T) {
+	// the generated names can't be written in a program
+	l := lexer.New(gensym("tmp"))
+	tok := l.NextToken()
+	assert.EqualValues(t, token.IDENT, tok.Type)
+	assert.Equal(t, "tmp__", tok.Literal)
+	assert.EqualValues(t, token.INT, l.NextToken().Type)
+
+	// so a caller's variable doesn't collide with them
+	res, err := expandAndEval(&Expander{}, `
+	let tmp__ = 5;
+	let m = macro() { quote(if (true) { let tmp = 1; tmp + tmp__ }) };
+	m()
+`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "6", res.Inspect())
+	}
+}
+
+// expandAndEval expands the macros of the input with x, then evaluates it.
+func expandAndEval(x *Expander, input string) (object.Object, error) {
+	env := object.NewEnvironment(nil)
+	program, err := stringToAst(input)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := x.Expand(program.(*ast.Program), env)
+	if err != nil {
+		return nil, err
+	}
+	return Eval(expanded, env)
+}
+
+func TestExpandNestedScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`
+	let f = fn(x) {
+		let twice = macro(e) { quote(unquote(e) * 2) };
+		twice(x)
+	};
+	f(21)
+`, "42"},
+		// the inner macro shadows the outer one only inside its block
+		{`
+	let m = macro() { quote(1) };
+	let f = fn() {
+		let m = macro() { quote(2) };
+		m()
+	};
+	[m(), f(), if (true) { let m = macro() { quote(3) }; m() }, m()]
+`, "[1,2,3,1]"},
+		// the outer macros are visible in the nested blocks
+		{`
+	let inc = macro(e) { quote(unquote(e) + 1) };
+	let f = fn() { fn() { inc(1) }() };
+	f()
+`, "2"},
+		// a macro defined in a block doesn't leak, m is a normal function call outside
+		{`
+	let g = fn() { let m = macro() { quote(1) }; m() };
+	let m = fn() { 100 };
+	[g(), m()]
+`, "[1,100]"},
+	}
+	for _, tc := range tests {
+		res, err := expandAndEval(&Expander{}, tc.input)
+		assert.Nil(t, err, tc.input)
+		if assert.NotNil(t, res, tc.input) {
+			assert.Equal(t, tc.expected, res.Inspect(), tc.input)
+		}
+	}
+}
+
+func TestExpandMacroPlacementError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let ms = [macro(x) { x }];`, "1:11: a macro can only be defined by a let statement in a program or a block"},
+		{`f(macro(x) { x });`, "1:3: a macro can only be defined by a let statement"},
+		{"let f = fn() {\n  return macro(x) { x };\n};", "2:10: a macro can only be defined by a let statement"},
+		{"let f = fn() {\n import_macros(\"lib.mk\");\n};", "2:2: import_macros is only allowed at the top level of a program"},
+		{"let f = fn() {\n export_macros(m);\n let m = macro() { quote(1) };\n};", "2:2: export_macros is only allowed at the top level of a program"},
+		{`import_macros("lib.mk");`, `1:1: import_macros("lib.mk"): importing is not enabled`},
+	}
+	for _, tc := range tests {
+		_, err := expandAndEval(&Expander{}, tc.input)
+		if assert.NotNil(t, err, tc.input) {
+			assert.Contains(t, err.Error(), tc.expected, tc.input)
+		}
+	}
+
+	// a quoted macro literal is just data
+	res, err := expandAndEval(&Expander{}, `quote(macro(x) { x })`)
+	assert.Nil(t, err)
+	assert.Equal(t, "QUOTE(macro(x)x)", res.Inspect())
+}
+
+func TestImportMacros(t *testing.T) {
+	modules := map[string]string{
+		"lib.mk": `
+	import_macros("base.mk");
+	let unless = macro(cond, a, b) { quote(if (!(unquote(cond))) { unquote(a) } else { unquote(b) }) };
+	let hidden = macro() { quote(0) };
+	export_macros(unless, twice);
+`,
+		"base.mk": `
+	let twice = macro(e) { quote(unquote(e) * 2) };
+	let thrice = macro(e) { quote(unquote(e) * 3) };
+	export_macros(twice);
+`,
+		"none.mk": `let m = macro() { quote(1) };`,
+		"fn.mk":   `let f = fn() { 1 }; export_macros(f);`,
+		"a.mk":    `import_macros("b.mk");`,
+		"b.mk":    `import_macros("a.mk");`,
+		"c.mk":    `import_macros("./c.mk");`,
+		"fn_helper.mk": `
+	let helper = fn(x) { x * 2 };
+	let m = macro(e) { quote(helper(unquote(e))) };
+	export_macros(m);
+`,
+		"error.mk": `export_macros(1);`,
+		"helper.mk": `
+	let double = macro(e) { quote(unquote(e) * 2) };
+	let quadruple = macro(e) { quote(double(double(unquote(e)))) };
+	export_macros(quadruple);
+`,
+	}
+	x := &Expander{
+		Import: func(path string) (*ast.Program, error) {
+			src, ok := modules[path]
+			if !ok {
+				return nil, fmt.Errorf("no such module")
+			}
+			p, err := stringToAst(src)
+			if err != nil {
+				return nil, err
+			}
+			return p.(*ast.Program), nil
+		},
+	}
+
+	res, err := expandAndEval(x, `
+	import_macros("lib.mk");
+	[unless(1 > 2, "yes", "no"), twice(twice(5))]
+`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		// twice is imported by lib.mk from base.mk, and exported again
+		assert.Equal(t, "[yes,20]", res.Inspect())
+	}
+
+	// the expanded code calls a helper which is not exported, the arguments still call the macros of the caller
+	res, err = expandAndEval(x, `
+	import_macros("helper.mk");
+	let inc = macro(e) { quote(unquote(e) + 1) };
+	quadruple(inc(2))
+`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "12", res.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import_macros("lib.mk"); hidden()`, "undefined"},
+		{`import_macros("lib.mk"); thrice(1)`, "undefined"},
+		{`import_macros("helper.mk"); double(1)`, "undefined"},
+		// only the macros are imported, not the functions of the module
+		{`import_macros("fn_helper.mk"); m(1)`, "undefined identifier: helper"},
+		{`import_macros("nope.mk");`, `1:1: import_macros("nope.mk"): no such module`},
+		{`import_macros("none.mk");`, `import_macros("none.mk"): no macros are exported`},
+		{`import_macros("fn.mk");`, `import_macros("fn.mk"): 1:35: f is exported but it is not a macro`},
+		{`import_macros("a.mk");`, `import cycle: a.mk -> b.mk -> a.mk`},
+		{`import_macros("c.mk");`, `import cycle: c.mk -> c.mk`},
+		{`import_macros("error.mk");`, `export_macros expects the names of macros, but got 1`},
+		{`import_macros(lib);`, `import_macros expects a string literal, but got lib`},
+	}
+	for _, tc := range tests {
+		_, err := expandAndEval(x, tc.input)
+		if assert.NotNil(t, err, tc.input) {
+			assert.Contains(t, err.Error(), tc.expected, tc.input)
+		}
+	}
+}
+
+func TestFileImporter(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(`let one = macro() { quote(1) }; export_macros(one);`), 0o644))
+
+	res, err := expandAndEval(&Expander{Import: FileImporter(dir)}, `import_macros("lib.mk"); one() + 1`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "2", res.Inspect())
+	}
+	_, err = FileImporter(dir)("nope.mk")
+	assert.NotNil(t, err)
+
+	// the modules imported by lib/a.mk are in lib
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "lib"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "lib", "a.mk"), []byte(`import_macros("b.mk"); export_macros(two);`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "lib", "b.mk"), []byte(`let two = macro() { quote(2) }; export_macros(two);`), 0o644))
+	res, err = expandAndEval(&Expander{Import: FileImporter(dir)}, `import_macros("lib/a.mk"); two()`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "2", res.Inspect())
+	}
+}
+
+func TestSandboxImporter(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "lib.mk"), []byte(`let one = macro() { quote(1) }; export_macros(one);`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(outside, "secret.mk"), []byte(`let two = macro() { quote(2) }; export_macros(two);`), 0o644))
+
+	importer, err := SandboxImporter(root, IOPolicy{Roots: []string{root}})
+	assert.Nil(t, err)
+	res, err := expandAndEval(&Expander{Import: importer}, `import_macros("lib.mk"); one()`)
+	assert.Nil(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "1", res.Inspect())
+	}
+	for _, path := range []string{filepath.Join(outside, "secret.mk"), filepath.Join("..", filepath.Base(outside), "secret.mk")} {
+		_, err = expandAndEval(&Expander{Import: importer}, fmt.Sprintf("import_macros(%q);", path))
+		assert.ErrorContains(t, err, "is not allowed", path)
+	}
+
+	_, err = SandboxImporter(root, IOPolicy{Roots: []string{filepath.Join(root, "nope")}})
+	assert.ErrorContains(t, err, "invalid io root")
+}
+
+func TestImportMacrosOptions(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(`
+let twice = macro(e) { quote(unquote(e) * 2) };
+let quadruple = macro(e) { quote(twice(twice(unquote(e)))) };
+quadruple(1);
+export_macros(twice);
+`), 0o644))
+
+	// the options of the expander apply to the imported modules too
+	var out bytes.Buffer
+	_, err := expandAndEval(&Expander{Import: FileImporter(dir), Trace: &out}, `import_macros("lib.mk"); twice(2)`)
+	assert.Nil(t, err)
+	assert.Equal(t, `4:1: quadruple(1) -> twice(twice(1))
+  3:40: twice(1) -> 1 * 2
+  3:34: twice(1 * 2) -> 1 * 2 * 2
+1:26: twice(2) -> 2 * 2
+`, out.String())
+
+	_, err = expandAndEval(&Expander{Import: FileImporter(dir), MaxDepth: 1}, `import_macros("lib.mk");`)
+	assert.ErrorContains(t, err, "expand macro twice: the expansion is deeper than 1 levels")
+}
+
+func TestExpandRecursively(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// the expanded node has a macro call
+		{`
+	let twice = macro(e) { quote(unquote(e) * 2) };
+	let quadruple = macro(e) { quote(twice(twice(unquote(e)))) };
+	quadruple(3)
+`, "12"},
+		// a recursive macro ends when it doesn't expand to itself
+		{`
+	let rep = macro(n, e) {
+		let k = eval(n);
+		if (k == 0) { quote(null) } else { quote([unquote(e), rep(unquote(k - 1), unquote(e))]) }
+	};
+	rep(2, 7)
+`, "[7,[7,null]]"},
+		// a macro defined in a block is used by the expanded node in the block
+		{`
+	let f = fn() {
+		let one = macro() { quote(1) };
+		let two = macro() { quote(one() + one()) };
+		two()
+	};
+	f()
+`, "2"},
+	}
+	for _, tc := range tests {
+		res, err := expandAndEval(&Expander{}, tc.input)
+		assert.Nil(t, err, tc.input)
+		if assert.NotNil(t, res, tc.input) {
+			assert.Equal(t, tc.expected, res.Inspect(), tc.input)
+		}
+	}
+}
+
+func TestExpandMaxDepth(t *testing.T) {
+	input := "let forever = macro(x) {\n  quote(forever(unquote(x)))\n};\nforever(1)"
+	_, err := expandAndEval(&Expander{}, input)
+	var e *MacroError
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, "2:9: expand macro forever: the expansion is deeper than 100 levels, the macro may expand to itself endlessly\n"+
+			"\tin the expansion of forever at 2:9 (99 times)\n"+
+			"\tin the expansion of forever at 4:1", e.Error())
+	}
+
+	// the nested depth is limited, not the number of expansions
+	input = `
+	let twice = macro(e) { quote(unquote(e) * 2) };
+	let quadruple = macro(e) { quote(twice(twice(unquote(e)))) };
+	[quadruple(1), quadruple(2), twice(twice(twice(1)))]
+`
+	res, err := expandAndEval(&Expander{MaxDepth: 2}, input)
+	assert.Nil(t, err)
+	assert.Equal(t, "[4,8,8]", res.Inspect())
+	_, err = expandAndEval(&Expander{MaxDepth: 1}, input)
+	assert.ErrorContains(t, err, "expand macro twice: the expansion is deeper than 1 levels")
+	assert.ErrorContains(t, err, "in the expansion of quadruple at 4:3")
+}
+
+func TestExpandTraceNested(t *testing.T) {
+	var out bytes.Buffer
+	_, err := expandAndEval(&Expander{Trace: &out}, `
+let twice = macro(e) { quote(unquote(e) * 2) };
+let quadruple = macro(e) { quote(twice(twice(unquote(e)))) };
+quadruple(3);
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, `4:1: quadruple(3) -> twice(twice(3))
+  3:40: twice(3) -> 3 * 2
+  3:34: twice(3 * 2) -> 3 * 2 * 2
+`, out.String())
+}
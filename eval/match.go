@@ -0,0 +1,283 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// evalMatch evaluates the body of the first arm whose pattern matches the value and whose guard is true.
+// The names bound by the pattern are only visible to the guard and the body of the arm.
+func evalMatch(node *ast.MatchExpression, env *object.Environment) (object.Object, error) {
+	value, err := Eval(node.Value, env)
+	if err != nil {
+		return nil, err
+	}
+	for _, arm := range node.Arms {
+		armEnv := object.NewEnvironment(env)
+		ok, err := match(arm.Pattern, value, armEnv)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if arm.Guard != nil {
+			guard, err := Eval(arm.Guard, armEnv)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue(guard) {
+				continue
+			}
+		}
+		res, err := Eval(arm.Body, armEnv)
+		if res == nil && err == nil {
+			// an empty body
+			return NULL, nil
+		}
+		return res, err
+	}
+	return nil, fmt.Errorf("%s: no pattern of the match matches %s\n", node.Token.Pos, value.Inspect())
+}
+
+// match reports whether the value matches the pattern, binding the names in the pattern in env.
+//   - _ matches anything, other identifiers bind the value.
+//   - a literal, e.g. 1, -1, "s", true or null, matches an equal value.
+//   - an array pattern matches an array of the same length, or longer if it ends with ...rest,
+//     which binds the rest elements.
+//   - a hash pattern matches a hash having all of its keys, the other keys are ignored.
+//     An identifier key is the name of a key, {name: n} is {"name": n}.
+func match(pattern ast.Expression, value object.Object, env *object.Environment) (bool, error) {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Value != "_" {
+			env.Set(p.Value, value)
+		}
+		return true, nil
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanExpression, *ast.NullExpression:
+		lit, err := Eval(p, env)
+		if err != nil {
+			return false, err
+		}
+		return object.Equal(lit, value), nil
+	case *ast.PrefixExpression:
+		if _, ok := p.Rhs.(*ast.IntegerLiteral); !ok || p.Op != "-" {
+			break
+		}
+		lit, err := Eval(p, env)
+		if err != nil {
+			return false, err
+		}
+		return object.Equal(lit, value), nil
+	case *ast.ArrayLiteral:
+		return matchArray(p, value, env)
+	case *ast.HashLiteral:
+		return matchHash(p, value, env)
+	}
+	return false, fmt.Errorf("%s is not a valid pattern\n", pattern.String())
+}
+
+func matchArray(pattern *ast.ArrayLiteral, value object.Object, env *object.Environment) (bool, error) {
+	elems, rest, err := splitRest(pattern.Elements)
+	if err != nil {
+		return false, err
+	}
+	arr, ok := value.(*object.Array)
+	if !ok || len(arr.Elements) < len(elems) || rest == nil && len(arr.Elements) != len(elems) {
+		return false, nil
+	}
+	for i, e := range elems {
+		if ok, err := match(e, arr.Elements[i], env); !ok || err != nil {
+			return false, err
+		}
+	}
+	if rest != nil && rest.Name.Value != "_" {
+		elements := make([]object.Object, len(arr.Elements)-len(elems))
+		copy(elements, arr.Elements[len(elems):])
+		env.Set(rest.Name.Value, &object.Array{Elements: elements})
+	}
+	return true, nil
+}
+
+// splitRest splits the ...rest at the end of a list pattern from the other elements.
+func splitRest(list []ast.Expression) ([]ast.Expression, *ast.RestExpression, error) {
+	for i, e := range list {
+		rest, ok := e.(*ast.RestExpression)
+		if !ok {
+			continue
+		}
+		if i != len(list)-1 {
+			return nil, nil, fmt.Errorf("the rest pattern %s should be the last one\n", rest.String())
+		}
+		return list[:i], rest, nil
+	}
+	return list, nil, nil
+}
+
+func matchHash(pattern *ast.HashLiteral, value object.Object, env *object.Environment) (bool, error) {
+	h, ok := value.(*object.Hash)
+	if !ok {
+		return false, nil
+	}
+	for _, pair := range pattern.Pairs {
+		key, err := patternKey(pair.Key, env)
+		if err != nil {
+			return false, err
+		}
+		v, ok := h.Get(key)
+		if !ok {
+			return false, nil
+		}
+		if ok, err := match(pair.Value, v, env); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func patternKey(key ast.Expression, env *object.Environment) (object.Hashable, error) {
+	switch key := key.(type) {
+	case *ast.Identifier:
+		return &object.String{Value: key.Value}, nil
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanExpression:
+		k, err := Eval(key, env)
+		if err != nil {
+			return nil, err
+		}
+		return k.(object.Hashable), nil
+	}
+	return nil, fmt.Errorf("%s is not a valid key of a hash pattern\n", key.String())
+}
+
+// patternNames returns the identifiers bound by a pattern, and the identifiers used as hash keys,
+// which are names of keys instead of variables.
+func patternNames(pattern ast.Expression) (names, keys []*ast.Identifier) {
+	var collect func(p ast.Expression)
+	collect = func(p ast.Expression) {
+		switch p := p.(type) {
+		case *ast.Identifier:
+			if p.Value != "_" {
+				names = append(names, p)
+			}
+		case *ast.RestExpression:
+			collect(p.Name)
+		case *ast.ArrayLiteral:
+			for _, e := range p.Elements {
+				collect(e)
+			}
+		case *ast.HashLiteral:
+			for _, pair := range p.Pairs {
+				if id, ok := pair.Key.(*ast.Identifier); ok {
+					keys = append(keys, id)
+				}
+				collect(pair.Value)
+			}
+		}
+	}
+	collect(pattern)
+	return names, keys
+}
+
+// destructure binds the names in the pattern of a let statement or a parameter to the parts of the value,
+// e.g. let [a, ...rest] = arr; or let {name, age: years} = user;
+// Unlike match, it's an error if the shape of the value doesn't fit the pattern.
+func destructure(pattern ast.Expression, value object.Object, env *object.Environment) error {
+	switch p := pattern.(type) {
+	case *ast.Identifier:
+		if p.Value != "_" {
+			env.Set(p.Value, value)
+		}
+		return nil
+	case *ast.ArrayLiteral:
+		elems, rest, err := splitRest(p.Elements)
+		if err != nil {
+			return err
+		}
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return fmt.Errorf("%s: expected an ARRAY, but got %s\n", p.String(), value.Type())
+		}
+		if rest == nil && len(arr.Elements) != len(elems) {
+			return fmt.Errorf("%s: expected %d elements, but got %d\n", p.String(), len(elems), len(arr.Elements))
+		}
+		if len(arr.Elements) < len(elems) {
+			return fmt.Errorf("%s: expected at least %d elements, but got %d\n", p.String(), len(elems), len(arr.Elements))
+		}
+		for i, e := range elems {
+			if err := destructure(e, arr.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if rest != nil && rest.Name.Value != "_" {
+			elements := make([]object.Object, len(arr.Elements)-len(elems))
+			copy(elements, arr.Elements[len(elems):])
+			env.Set(rest.Name.Value, &object.Array{Elements: elements})
+		}
+		return nil
+	case *ast.HashLiteral:
+		h, ok := value.(*object.Hash)
+		if !ok {
+			return fmt.Errorf("%s: expected a HASH, but got %s\n", p.String(), value.Type())
+		}
+		for _, pair := range p.Pairs {
+			key, err := patternKey(pair.Key, env)
+			if err != nil {
+				return err
+			}
+			v, ok := h.Get(key)
+			if !ok {
+				return fmt.Errorf("%s: the key %s is missing in %s\n", p.String(), key.Inspect(), value.Inspect())
+			}
+			if err := destructure(pair.Value, v, env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ok, err := match(pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't match %s\n", pattern.String(), value.Inspect())
+	}
+	return nil
+}
+
+// parameters checks the parameters of a function literal being evaluated, they're identifiers or array or hash patterns.
+func parameters(params []ast.Expression) ([]ast.Expression, error) {
+	for _, p := range params {
+		switch p := p.(type) {
+		case *ast.Identifier, *ast.ArrayLiteral, *ast.HashLiteral:
+		case *ast.RestExpression:
+			return nil, fmt.Errorf("...%s: only macros can have a rest parameter\n", p.Name.Value)
+		default:
+			return nil, fmt.Errorf("%s can only be used as a parameter in quote\n", p.String())
+		}
+	}
+	return params, nil
+}
+
+// macroParameters returns the names of the parameters, and the rest parameter if any.
+func macroParameters(params []ast.Expression) ([]*ast.Identifier, *ast.Identifier, error) {
+	res := make([]*ast.Identifier, 0, len(params))
+	var rest *ast.Identifier
+	for i, p := range params {
+		switch p := p.(type) {
+		case *ast.Identifier:
+			res = append(res, p)
+		case *ast.RestExpression:
+			if i != len(params)-1 {
+				return nil, nil, fmt.Errorf("the rest parameter %s should be the last one\n", p.String())
+			}
+			rest = p.Name
+		case *ast.ArrayLiteral, *ast.HashLiteral:
+			return nil, nil, fmt.Errorf("%s: a macro parameter can't be a pattern\n", p.String())
+		default:
+			return nil, nil, fmt.Errorf("%s can only be used as a parameter in quote\n", p.String())
+		}
+	}
+	return res, rest, nil
+}
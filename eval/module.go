@@ -0,0 +1,150 @@
+package eval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/lexer"
+	"github.com/ChaosNyaruko/monkey/object"
+	"github.com/ChaosNyaruko/monkey/parser"
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+// The macros are shared between files by the directives at the top level of a program:
+//
+//	export_macros(unless, swap); // in lib.mk
+//	import_macros("lib.mk");     // binds unless and swap
+//
+// They are handled during the macro expansion, and removed from the program.
+// Only the macros of a module are imported, its other statements are dropped, so the code expanded by
+// an imported macro can't call the functions defined by the module.
+var moduleDirectives = map[string]bool{
+	"import_macros": true,
+	"export_macros": true,
+}
+
+// FileImporter imports the modules from the files, the relative paths are relative to dir.
+func FileImporter(dir string) func(path string) (*ast.Program, error) {
+	return fileImporter(dir, nil)
+}
+
+// SandboxImporter imports the modules like FileImporter, but only from the roots of the policy, e.g. the one given to EnableIO.
+func SandboxImporter(dir string, policy IOPolicy) (func(path string) (*ast.Program, error), error) {
+	s, err := newSandbox(policy)
+	if err != nil {
+		return nil, err
+	}
+	return fileImporter(dir, s.resolve), nil
+}
+
+// fileImporter imports the modules from the files, the paths are checked by resolve if it's not nil.
+func fileImporter(dir string, resolve func(path string) (string, error)) func(path string) (*ast.Program, error) {
+	return func(path string) (*ast.Program, error) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if resolve != nil {
+			var err error
+			if path, err = resolve(path); err != nil {
+				return nil, err
+			}
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p := parser.New(lexer.New(string(b)))
+		program := p.ParseProgram()
+		if err := p.Error(); err != nil {
+			return nil, err
+		}
+		return program, nil
+	}
+}
+
+func moduleDirective(s ast.Statement) (*ast.CallExpression, bool) {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	call, ok := es.Expression.(*ast.CallExpression)
+	if !ok {
+		return nil, false
+	}
+	id, ok := call.F.(*ast.Identifier)
+	return call, ok && moduleDirectives[id.Value]
+}
+
+func directivePos(call *ast.CallExpression) token.Position {
+	return call.F.(*ast.Identifier).Token.Pos
+}
+
+// module runs an import_macros or export_macros directive.
+func (x *Expander) module(call *ast.CallExpression, env *object.Environment) error {
+	pos := directivePos(call)
+	if call.F.String() == "export_macros" {
+		for _, a := range call.Arguments {
+			id, ok := a.(*ast.Identifier)
+			if !ok {
+				return fmt.Errorf("%s: export_macros expects the names of macros, but got %s", pos, a)
+			}
+			x.exports = append(x.exports, id)
+		}
+		return nil
+	}
+
+	if len(call.Arguments) != 1 {
+		return fmt.Errorf("%s: import_macros expects a path, e.g. import_macros(\"lib.mk\")", pos)
+	}
+	lit, ok := call.Arguments[0].(*ast.StringLiteral)
+	if !ok {
+		return fmt.Errorf("%s: import_macros expects a string literal, but got %s", pos, call.Arguments[0])
+	}
+	path := lit.Value
+	if x.Import == nil {
+		return fmt.Errorf("%s: import_macros(%q): importing is not enabled", pos, path)
+	}
+	// a relative path is relative to the module importing it, a.mk and ./a.mk are the same module
+	name := path
+	if len(x.importing) > 0 && !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(x.importing[len(x.importing)-1]), name)
+	}
+	name = filepath.Clean(name)
+	if slices.Contains(x.importing, name) {
+		return fmt.Errorf("%s: import cycle: %s -> %s", pos, strings.Join(x.importing, " -> "), name)
+	}
+	program, err := x.Import(name)
+	if err != nil {
+		return fmt.Errorf("%s: import_macros(%q): %w", pos, path, err)
+	}
+
+	module := &Expander{
+		OnExpand:  x.OnExpand,
+		Import:    x.Import,
+		Trace:     x.Trace,
+		MaxDepth:  x.MaxDepth,
+		importing: append(slices.Clone(x.importing), name),
+	}
+	moduleEnv := object.NewEnvironment(nil)
+	if _, err := module.Expand(program, moduleEnv); err != nil {
+		return fmt.Errorf("%s: import_macros(%q): %w", pos, path, err)
+	}
+	if len(module.exports) == 0 {
+		return fmt.Errorf("%s: import_macros(%q): no macros are exported, use export_macros(name, ...)", pos, path)
+	}
+	for _, id := range module.exports {
+		obj, err := moduleEnv.Get(id.Value)
+		m, ok := obj.(*object.Macro)
+		if err != nil || !ok {
+			return fmt.Errorf("%s: import_macros(%q): %s: %s is exported but it is not a macro", pos, path, id.Token.Pos, id.Value)
+		}
+		if _, err := env.Set(id.Value, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
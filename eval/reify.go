@@ -0,0 +1,209 @@
+package eval
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/object"
+	"github.com/ChaosNyaruko/monkey/token"
+)
+
+// reify converts an object back into an expression which evaluates to an equal object,
+// so that computed data can be spliced into code by unquote.
+//
+// A function is converted into a function literal, the captured variables become let statements
+// at the beginning of its body, e.g. the closure of
+//
+//	let add = fn(x) { fn(y) { x + y } }; add(1)
+//
+// is converted into fn(y) { let x = 1; x + y }. It's only possible if the captured objects can be
+// converted too, e.g. a recursive function can't.
+func reify(obj object.Object) (ast.Expression, error) {
+	r := &reifier{functions: map[*object.Function]bool{}}
+	return r.reify(obj)
+}
+
+type reifier struct {
+	functions map[*object.Function]bool // the functions being converted, to detect the cycles
+}
+
+func (r *reifier) reify(obj object.Object) (ast.Expression, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: strconv.Itoa(obj.Value)},
+			Value: obj.Value,
+		}, nil
+	case *object.Boolean:
+		t := token.Token{Type: token.FALSE, Literal: "false"}
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		}
+		return &ast.BooleanExpression{Token: t, Value: obj.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: obj.Value}, Value: obj.Value}, nil
+	case *object.Null:
+		return &ast.NullExpression{Token: token.Token{Type: token.NULL, Literal: "null"}}, nil
+	case *object.Array:
+		res := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: []ast.Expression{}}
+		for _, e := range obj.Elements {
+			re, err := r.reify(e)
+			if err != nil {
+				return nil, err
+			}
+			res.Elements = append(res.Elements, re)
+		}
+		return res, nil
+	case *object.Hash:
+		res := &ast.HashLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{"}, Pairs: []ast.HashPair{}}
+		for _, p := range obj.Pairs() {
+			k, err := r.reify(p.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := r.reify(p.Value)
+			if err != nil {
+				return nil, err
+			}
+			res.Pairs = append(res.Pairs, ast.HashPair{Key: k, Value: v})
+		}
+		return res, nil
+	case *object.Quote:
+		// a quote inside other data is a value too, unlike the one unquoted directly, which is spliced.
+		node, ok := ast.Clone(obj.Node).(ast.Expression)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %s into an expression", obj.Inspect())
+		}
+		return &ast.CallExpression{
+			Token:     token.Token{Type: token.LPAREN, Literal: "("},
+			F:         identifier("quote"),
+			Arguments: []ast.Expression{node},
+		}, nil
+	case *object.Builtin:
+		// refer to it by name, it's the same everywhere unless shadowed.
+		return identifier(obj.Name), nil
+	case *object.Function:
+		return r.function(obj)
+	}
+	return nil, fmt.Errorf("cannot convert %s into an expression", obj.Inspect())
+}
+
+func (r *reifier) function(f *object.Function) (ast.Expression, error) {
+	if r.functions[f] {
+		return nil, fmt.Errorf("cannot convert a recursive function %s into an expression", f.Inspect())
+	}
+	r.functions[f] = true
+	defer delete(r.functions, f)
+
+	lit := &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: cloneParameters(f.Parameters),
+		Body:       &ast.BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{"}},
+	}
+	for _, name := range freeNames(lit.Parameters, f.Body) {
+		v, err := f.Env.Get(name)
+		if err != nil {
+			// a builtin or a special form, or it's not defined at all
+			continue
+		}
+		value, err := r.reify(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert the captured %s: %w", name, err)
+		}
+		lit.Body.Statements = append(lit.Body.Statements, &ast.LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  identifier(name),
+			Value: value,
+		})
+	}
+	body := ast.Clone(f.Body).(*ast.BlockStatement)
+	lit.Body.Statements = append(lit.Body.Statements, body.Statements...)
+	return lit, nil
+}
+
+func identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func cloneParameters(params []ast.Expression) []ast.Expression {
+	res := make([]ast.Expression, 0, len(params))
+	for _, p := range params {
+		res = append(res, ast.Clone(p).(ast.Expression))
+	}
+	return res
+}
+
+// freeNames returns the names used by a function but not bound inside it, in the order of their first uses.
+// Like the checker, a name bound by a let anywhere in the function is considered bound in the whole function.
+// The quoted code is data, only the unquoted parts are looked into.
+func freeNames(params []ast.Expression, body *ast.BlockStatement) []string {
+	bound := map[string]bool{}
+	for _, p := range params {
+		names, _ := patternNames(p)
+		for _, id := range names {
+			bound[id.Value] = true
+		}
+	}
+	var uses []string
+	var inspect func(node ast.Node)
+	inspect = func(node ast.Node) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.LetStatement:
+				names, _ := patternNames(n.Name)
+				for _, id := range names {
+					bound[id.Value] = true
+				}
+				inspect(n.Value)
+				return false
+			case *ast.MatchExpression:
+				inspect(n.Value)
+				for _, a := range n.Arms {
+					names, _ := patternNames(a.Pattern)
+					for _, id := range names {
+						bound[id.Value] = true
+					}
+					if a.Guard != nil {
+						inspect(a.Guard)
+					}
+					inspect(a.Body)
+				}
+				return false
+			case *ast.FunctionLiteral:
+				uses = append(uses, freeNames(n.Parameters, n.Body)...)
+				return false
+			case *ast.MacroLiteral:
+				uses = append(uses, freeNames(n.Parameters, n.Body)...)
+				return false
+			case *ast.CallExpression:
+				if n.F.TokenLiteral() == "quote" {
+					for _, a := range n.Arguments {
+						ast.Inspect(a, func(q ast.Node) bool {
+							if code, ok := unquoted(q); ok {
+								inspect(code)
+								return false
+							}
+							return true
+						})
+					}
+					return false
+				}
+			case *ast.Identifier:
+				uses = append(uses, n.Value)
+			}
+			return true
+		})
+	}
+	inspect(body)
+
+	var res []string
+	seen := map[string]bool{}
+	for _, name := range uses {
+		if !bound[name] && !seen[name] {
+			seen[name] = true
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// ExitError is returned by the exit builtin, it unwinds the whole evaluation
+// and carries the status the host process should exit with.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func Exit(args ...object.Object) (object.Object, error) {
+	if len(args) == 0 {
+		return nil, &ExitError{Code: 0}
+	}
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", 1, len(args))
+	}
+	code, ok := args[0].(*object.Integer)
+	if !ok {
+		return nil, fmt.Errorf("exit code should be an INTEGER, but got %v\n", args[0].Type())
+	}
+	return nil, &ExitError{Code: code.Value}
+}
+
+// EnableScript exposes the command-line arguments of a script as the `args` array,
+// and lets it read the host's environment variables with the `env` builtin.
+func EnableScript(env *object.Environment, args []string) error {
+	arr := &object.Array{Elements: make([]object.Object, 0, len(args))}
+	for _, a := range args {
+		arr.Elements = append(arr.Elements, &object.String{Value: a})
+	}
+	if _, err := env.Set("args", arr); err != nil {
+		return err
+	}
+	_, err := env.Set("env", &object.Builtin{Name: "env", Fn: object.Simple(Getenv)})
+	return err
+}
+
+// Getenv returns the value of the environment variable, or null if it is not set.
+func Getenv(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", 1, len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("env: name should be a STRING, but got %v\n", args[0].Type())
+	}
+	v, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return NULL, nil
+	}
+	return &object.String{Value: v}, nil
+}
@@ -0,0 +1,59 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+func TestScriptArgsAndEnv(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+
+	type testcase struct {
+		input    string
+		expected string
+	}
+	for _, tc := range []testcase{
+		{`args`, "[a,b,c]"},
+		{`len(args)`, "3"},
+		{`args[1]`, "b"},
+		{`env("MONKEY_TEST_VAR")`, "banana"},
+		{`env("MONKEY_TEST_UNSET_VAR")`, "null"},
+	} {
+		program, err := stringToAst(tc.input)
+		require.Nil(t, err)
+		env := object.NewEnvironment(nil)
+		require.Nil(t, EnableScript(env, []string{"a", "b", "c"}))
+		got, err := Eval(program, env)
+		require.Nil(t, err, "input: %v", tc.input)
+		assert.Equal(t, tc.expected, got.Inspect(), "input: %v", tc.input)
+	}
+
+	_, err := stringToObject(`env("MONKEY_TEST_VAR")`)
+	assert.ErrorContains(t, err, "not enabled")
+}
+
+func TestExit(t *testing.T) {
+	type testcase struct {
+		input string
+		code  int
+	}
+	for _, tc := range []testcase{
+		{`exit()`, 0},
+		{`exit(3); print("unreachable")`, 3},
+		{`let f = fn(x) { if (x > 1) { exit(x) } else { 0 } }; print(f(7)); 1`, 7},
+		{`[1, {"k": exit(2)}]`, 2},
+	} {
+		_, err := stringToObject(tc.input)
+		var exit *ExitError
+		require.True(t, errors.As(err, &exit), "input: %v, err: %v", tc.input, err)
+		assert.Equal(t, tc.code, exit.Code, "input: %v", tc.input)
+	}
+
+	_, err := stringToObject(`exit("1")`)
+	assert.ErrorContains(t, err, "should be an INTEGER")
+}
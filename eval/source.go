@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/lexer"
+	"github.com/ChaosNyaruko/monkey/object"
+	"github.com/ChaosNyaruko/monkey/parser"
+)
+
+// parseSource parses the code given to eval or parse.
+func parseSource(src string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// Parse parses a string into a QUOTE, which can be evaluated or unquoted later.
+// The code of a single expression is quoted as the expression itself, so that it can be spliced anywhere,
+// otherwise the whole program is quoted.
+func Parse(args ...object.Object) (object.Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("wrong number of arguments, expected %d, but got %d\n", 1, len(args))
+	}
+	s, ok := args[0].(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("parse: the code should be a STRING, but got %v\n", args[0].Type())
+	}
+	program, err := parseSource(s.Value)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %v", err)
+	}
+	if len(program.Statements) == 1 {
+		if es, ok := program.Statements[0].(*ast.ExpressionStatement); ok {
+			return &object.Quote{Node: es.Expression}, nil
+		}
+	}
+	return &object.Quote{Node: program}, nil
+}
+
+// evalLiteral is the eval special form, eval(code) or eval(code, vars).
+// The code is a QUOTE or a STRING of source code, the macros in which are expanded first.
+// It's evaluated in the current environment, or a fresh one with only the variables
+// in the HASH vars, e.g. eval("x + 1", {"x": 1}).
+func evalLiteral(args []ast.Expression, env *object.Environment) (object.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments, expected 1 or 2, but got %d\n", len(args))
+	}
+	code, err := Eval(args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		vars, err := Eval(args[1], env)
+		if err != nil {
+			return nil, err
+		}
+		ctx := env.Context()
+		out, errOut := env.Output()
+		if env, err = freshEnvironment(vars); err != nil {
+			return nil, err
+		}
+		// a fresh environment, but the same evaluation
+		env.SetContext(ctx)
+		env.SetOutput(out, errOut)
+	}
+
+	switch c := code.(type) {
+	case *object.Quote:
+		return Eval(c.Node, env)
+	case *object.String:
+		program, err := parseSource(c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("eval: %v", err)
+		}
+		if _, err := (&Expander{}).Expand(program, env); err != nil {
+			return nil, fmt.Errorf("eval: expand macros err: %v\n", err)
+		}
+		res, err := Eval(program, env)
+		if res == nil && err == nil {
+			// nothing to evaluate
+			return NULL, nil
+		}
+		return res, err
+	}
+	return nil, fmt.Errorf("the 'eval' should be applied to a QUOTE or a STRING, but got: %s\n", code.Type())
+}
+
+func freshEnvironment(vars object.Object) (*object.Environment, error) {
+	h, ok := vars.(*object.Hash)
+	if !ok {
+		return nil, fmt.Errorf("eval: the variables should be a HASH, but got %v\n", vars.Type())
+	}
+	env := object.NewEnvironment(nil)
+	for _, p := range h.Pairs() {
+		name, ok := p.Key.(*object.String)
+		if !ok {
+			return nil, fmt.Errorf("eval: the variable names should be STRINGs, but got %v\n", p.Key.Type())
+		}
+		env.Set(name.Value, p.Value)
+	}
+	return env, nil
+}
@@ -0,0 +1,145 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/object"
+)
+
+// isSplice reports whether node is an unquote_splice(arr) call.
+func isSplice(node ast.Node) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	return call.F.TokenLiteral() == "unquote_splice" && len(call.Arguments) == 1
+}
+
+// unquoted returns the code an unquote or an unquote_splice call evaluates.
+func unquoted(node ast.Node) (ast.Expression, bool) {
+	if !isUnquote(node) && !isSplice(node) {
+		return nil, false
+	}
+	return node.(*ast.CallExpression).Arguments[0], true
+}
+
+// splice replaces the unquote_splice(arr) calls in the lists of node with the elements of the array,
+// like unquote does for one element. It's allowed where a list is expected: the elements of an array,
+// the arguments of a call, the parameters of a function and the statements of a block, e.g.
+//
+//	let args = [quote(1), quote(2)]; quote(f(0, unquote_splice(args))) -> f(0, 1, 2)
+func splice(node ast.Node, env *object.Environment) error {
+	var err error
+	switch n := node.(type) {
+	case *ast.ArrayLiteral:
+		n.Elements, err = spliceExpressions(n.Elements, env)
+	case *ast.CallExpression:
+		n.Arguments, err = spliceExpressions(n.Arguments, env)
+	case *ast.FunctionLiteral:
+		n.Parameters, err = spliceParameters(n.Parameters, env)
+	case *ast.MacroLiteral:
+		n.Parameters, err = spliceParameters(n.Parameters, env)
+	case *ast.BlockStatement:
+		n.Statements, err = spliceStatements(n.Statements, env)
+	}
+	return err
+}
+
+// spliced evaluates the argument of an unquote_splice call into nodes.
+func spliced(call ast.Expression, env *object.Environment) ([]ast.Node, error) {
+	obj, err := Eval(call.(*ast.CallExpression).Arguments[0], env)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := obj.(*object.Array)
+	if !ok {
+		return nil, fmt.Errorf("unquote_splice should be applied to an ARRAY, but got %s\n", obj.Type())
+	}
+	res := make([]ast.Node, 0, len(arr.Elements))
+	for _, e := range arr.Elements {
+		n, err := objectToNode(e)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func spliceExpressions(list []ast.Expression, env *object.Environment) ([]ast.Expression, error) {
+	var res []ast.Expression
+	for _, e := range list {
+		if !isSplice(e) {
+			res = append(res, e)
+			continue
+		}
+		nodes, err := spliced(e, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			ne, ok := n.(ast.Expression)
+			if !ok {
+				return nil, fmt.Errorf("unquote_splice: %s is not an expression\n", n.String())
+			}
+			res = append(res, ne)
+		}
+	}
+	return res, nil
+}
+
+// spliceParameters accepts identifiers and strings as the names of the parameters.
+func spliceParameters(list []ast.Expression, env *object.Environment) ([]ast.Expression, error) {
+	var res []ast.Expression
+	for _, e := range list {
+		if !isSplice(e) {
+			res = append(res, e)
+			continue
+		}
+		nodes, err := spliced(e, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *ast.Identifier:
+				res = append(res, n)
+			case *ast.StringLiteral:
+				res = append(res, identifier(n.Value))
+			default:
+				return nil, fmt.Errorf("unquote_splice: %s is not a parameter name\n", n.String())
+			}
+		}
+	}
+	return res, nil
+}
+
+// spliceStatements turns the expressions into expression statements, a quoted program is spliced as its statements.
+func spliceStatements(list []ast.Statement, env *object.Environment) ([]ast.Statement, error) {
+	var res []ast.Statement
+	for _, s := range list {
+		es, ok := s.(*ast.ExpressionStatement)
+		if !ok || !isSplice(es.Expression) {
+			res = append(res, s)
+			continue
+		}
+		nodes, err := spliced(es.Expression, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *ast.Program:
+				res = append(res, n.Statements...)
+			case ast.Statement:
+				res = append(res, n)
+			case ast.Expression:
+				res = append(res, &ast.ExpressionStatement{Expression: n})
+			default:
+				return nil, fmt.Errorf("unquote_splice: %s is not a statement\n", n.String())
+			}
+		}
+	}
+	return res, nil
+}
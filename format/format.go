@@ -0,0 +1,358 @@
+// Package format prints Monkey syntax trees as canonical, indented source code.
+//
+// The output always parses back to the same tree, and formatting it again doesn't change it.
+// Comments are not kept since the lexer drops them.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/lexer"
+	"github.com/ChaosNyaruko/monkey/parser"
+)
+
+// Source formats a whole script. The shebang line and single blank lines between statements are kept.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if err := p.Error(); err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(src), "\n")
+	pr := &printer{
+		blank: func(line int) bool {
+			return line >= 1 && line <= len(lines) && strings.TrimSpace(lines[line-1]) == ""
+		},
+	}
+	if strings.HasPrefix(lines[0], "#!") {
+		pr.out.WriteString(lines[0] + "\n")
+		if len(program.Statements) > 0 && pr.blank(2) {
+			pr.out.WriteString("\n")
+		}
+	}
+	pr.program(program)
+	return pr.out.Bytes(), nil
+}
+
+// Node formats a node, a program is printed one statement per line.
+func Node(node ast.Node) string {
+	pr := &printer{blank: func(int) bool { return false }}
+	switch n := node.(type) {
+	case *ast.Program:
+		pr.program(n)
+	case ast.Statement:
+		pr.statement(n, "")
+	case ast.Expression:
+		pr.expression(n)
+	default:
+		panic(fmt.Sprintf("format.Node: unexpected node type %T", n))
+	}
+	return pr.out.String()
+}
+
+// the precedences of the operators, the same as the parser's.
+const (
+	lowest = iota
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	primary
+)
+
+var infixPrecedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return infixPrecedences[e.Op]
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression:
+		return call
+	default:
+		return primary
+	}
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	blank  func(line int) bool // reports whether the line of the source is empty
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n" + strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) program(program *ast.Program) {
+	for i, s := range program.Statements {
+		if i > 0 && p.blank(line(s)-1) {
+			p.out.WriteString("\n")
+		}
+		p.statement(s, terminator(program.Statements, i, false))
+		p.out.WriteString("\n")
+	}
+}
+
+// line returns the line where the statement starts in the source, 0 for unknown.
+func line(s ast.Statement) int {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token.Pos.Line
+	case *ast.ReturnStatement:
+		return s.Token.Pos.Line
+	case *ast.ExpressionStatement:
+		return s.Token.Pos.Line
+	case *ast.BlockStatement:
+		return s.Token.Pos.Line
+	}
+	return 0
+}
+
+// terminator returns what ends the ith statement of a list, let and return statements always end with ";".
+// The last expression of a block is its value and an if or match expression ends with "}", they don't need one,
+// unless the next statement starts with a token which would continue the expression, e.g. "(" or "-".
+func terminator(list []ast.Statement, i int, block bool) string {
+	es, ok := list[i].(*ast.ExpressionStatement)
+	if !ok {
+		return ";"
+	}
+	if block && i == len(list)-1 {
+		return ""
+	}
+	switch es.Expression.(type) {
+	case *ast.IfExpression, *ast.MatchExpression:
+		if i == len(list)-1 || !strings.ContainsAny(Node(list[i+1])[:1], "([-") {
+			return ""
+		}
+	}
+	return ";"
+}
+
+func (p *printer) statement(s ast.Statement, end string) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let ")
+		p.expression(s.Name)
+		p.out.WriteString(" = ")
+		p.expression(s.Value)
+		p.out.WriteString(";")
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if s.ReturnValue != nil {
+			p.out.WriteString(" ")
+			p.expression(s.ReturnValue)
+		}
+		p.out.WriteString(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		p.out.WriteString(end)
+	case *ast.BlockStatement:
+		p.block(s, false)
+	default:
+		panic(fmt.Sprintf("format: unexpected statement type %T", s))
+	}
+}
+
+// inline returns the block as "{ expr }" if it only has an expression fitting in one line.
+func (p *printer) inline(b *ast.BlockStatement) (string, bool) {
+	if b == nil || len(b.Statements) != 1 {
+		return "", false
+	}
+	es, ok := b.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return "", false
+	}
+	e := &printer{blank: p.blank}
+	e.expression(es.Expression)
+	if strings.Contains(e.out.String(), "\n") {
+		return "", false
+	}
+	return "{ " + e.out.String() + " }", true
+}
+
+// block prints the statements of b indented, a block with only one short expression
+// is put in one line if oneLine is set.
+func (p *printer) block(b *ast.BlockStatement, oneLine bool) {
+	if len(b.Statements) == 0 {
+		p.out.WriteString("{}")
+		return
+	}
+	if s, ok := p.inline(b); ok && oneLine {
+		p.out.WriteString(s)
+		return
+	}
+	p.out.WriteString("{")
+	p.indent++
+	for i, s := range b.Statements {
+		if i > 0 && p.blank(line(s)-1) {
+			p.out.WriteString("\n")
+		}
+		p.newline()
+		p.statement(s, terminator(b.Statements, i, true))
+	}
+	p.indent--
+	p.newline()
+	p.out.WriteString("}")
+}
+
+// operand prints e, in parentheses if it binds looser than the operator.
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if parens {
+		p.out.WriteString("(")
+		p.expression(e)
+		p.out.WriteString(")")
+		return
+	}
+	p.expression(e)
+}
+
+func (p *printer) list(exprs []ast.Expression) {
+	for i, e := range exprs {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e)
+	}
+}
+
+func (p *printer) parameters(params []ast.Expression) {
+	p.out.WriteString("(")
+	p.list(params)
+	p.out.WriteString(") ")
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+	case *ast.IntegerLiteral:
+		p.out.WriteString(fmt.Sprintf("%d", e.Value))
+	case *ast.StringLiteral:
+		// strings have no escape sequences, they can't contain a quote
+		p.out.WriteString(`"` + e.Value + `"`)
+	case *ast.BooleanExpression:
+		p.out.WriteString(fmt.Sprintf("%t", e.Value))
+	case *ast.NullExpression:
+		p.out.WriteString("null")
+	case *ast.RestExpression:
+		p.out.WriteString("..." + e.Name.Value)
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Op)
+		p.operand(e.Rhs, precedence(e.Rhs) < prefix)
+	case *ast.InfixExpression:
+		// the operators are left associative: (a - b) - c is a - b - c, but a - (b - c) is not.
+		prec := infixPrecedences[e.Op]
+		p.operand(e.Lhs, precedence(e.Lhs) < prec)
+		p.out.WriteString(" " + e.Op + " ")
+		p.operand(e.Rhs, precedence(e.Rhs) <= prec)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition)
+		p.out.WriteString(") ")
+		// the branches are put in one line only if both of them fit
+		_, oneLine := p.inline(e.If)
+		if e.Else != nil {
+			_, ok := p.inline(e.Else)
+			oneLine = oneLine && ok
+		}
+		p.block(e.If, oneLine)
+		if e.Else != nil {
+			p.out.WriteString(" else ")
+			p.block(e.Else, oneLine)
+		}
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn")
+		p.parameters(e.Parameters)
+		p.block(e.Body, true)
+	case *ast.MacroLiteral:
+		p.out.WriteString("macro")
+		p.parameters(e.Parameters)
+		p.block(e.Body, true)
+	case *ast.CallExpression:
+		p.operand(e.F, precedence(e.F) < call)
+		p.out.WriteString("(")
+		p.list(e.Arguments)
+		p.out.WriteString(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < call)
+		p.out.WriteString("[")
+		p.expression(e.Index)
+		p.out.WriteString("]")
+	case *ast.SliceExpression:
+		p.operand(e.Left, precedence(e.Left) < call)
+		p.out.WriteString("[")
+		if e.Low != nil {
+			p.expression(e.Low)
+		}
+		p.out.WriteString(":")
+		if e.High != nil {
+			p.expression(e.High)
+		}
+		p.out.WriteString("]")
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(e.Elements)
+		p.out.WriteString("]")
+	case *ast.HashLiteral:
+		p.out.WriteString("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.expression(pair.Key)
+			p.out.WriteString(": ")
+			p.expression(pair.Value)
+		}
+		p.out.WriteString("}")
+	case *ast.MatchExpression:
+		p.out.WriteString("match (")
+		p.expression(e.Value)
+		p.out.WriteString(") {")
+		p.indent++
+		for _, a := range e.Arms {
+			p.newline()
+			p.arm(a)
+		}
+		p.indent--
+		p.newline()
+		p.out.WriteString("}")
+	default:
+		panic(fmt.Sprintf("format: unexpected expression type %T", e))
+	}
+}
+
+// arm prints an arm of a match, the body is put after "=>" if it's only one short expression.
+// A hash is put in parentheses, otherwise it would be parsed as a block.
+func (p *printer) arm(a ast.MatchArm) {
+	p.expression(a.Pattern)
+	if a.Guard != nil {
+		p.out.WriteString(" if ")
+		p.expression(a.Guard)
+	}
+	p.out.WriteString(" => ")
+	if _, ok := p.inline(a.Body); ok {
+		e := a.Body.Statements[0].(*ast.ExpressionStatement).Expression
+		_, hash := e.(*ast.HashLiteral)
+		p.operand(e, hash)
+	} else {
+		p.block(a.Body, false)
+	}
+	p.out.WriteString(",")
+}
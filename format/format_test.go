@@ -0,0 +1,97 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/lexer"
+	"github.com/ChaosNyaruko/monkey/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1+2", "1 + 2;\n"},
+		{"let add=fn(a,b){a+b};add(1,2)", "let add = fn(a, b) { a + b };\nadd(1, 2);\n"},
+		{"(1 + 2) * 3; 1 + (2 * 3); 1 - (2 - 3); (1 - 2) - 3", "(1 + 2) * 3;\n1 + 2 * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(1 + 2); -(-a); !(a == b); (-a)[0]; -a[0]", "-(1 + 2);\n--a;\n!(a == b);\n(-a)[0];\n-a[0];\n"},
+		{"(a < b) == (c > d); a < (b == c)", "a < b == c > d;\na < (b == c);\n"},
+		{"fn(x){x}(1); (fn(x){x})(1); f(1)(2); f(1)[0]; a[0](1)", "fn(x) { x }(1);\nfn(x) { x }(1);\nf(1)(2);\nf(1)[0];\na[0](1);\n"},
+		{`[1,"two",null,true]; {}; {"a":1,2:[3]}; []`, "[1, \"two\", null, true];\n{};\n{\"a\": 1, 2: [3]};\n[];\n"},
+		{"if(a){b}", "if (a) { b }\n"},
+		{"if(a){b}else{c}", "if (a) { b } else { c }\n"},
+		{"if(a){return b;}else{c}", "if (a) {\n\treturn b;\n} else {\n\tc\n}\n"},
+		{"if(a){}", "if (a) {}\n"},
+		// an if followed by "(", "[" or "-" would continue the expression without the ";"
+		{"if(a){b}; (c+1)*2; if(a){b}; [1]; if(a){b}; -1; if(a){b}; !c", "if (a) { b };\n(c + 1) * 2;\nif (a) { b };\n[1];\nif (a) { b };\n-1;\nif (a) { b }\n!c;\n"},
+		{"let f = fn() { let x = 1; if (x > 0) { return x; } x };", "let f = fn() {\n\tlet x = 1;\n\tif (x > 0) {\n\t\treturn x;\n\t}\n\tx\n};\n"},
+		{"let m = macro(a, b) {quote(unquote(b) - unquote(a))};", "let m = macro(a, b) { quote(unquote(b) - unquote(a)) };\n"},
+		{"let m = macro(a,...b) {a};", "let m = macro(a, ...b) { a };\n"},
+		{"a[1:3]; a[:-1]; (s+t)[i+1:]; a[:]", "a[1:3];\na[:-1];\n(s + t)[i + 1:];\na[:];\n"},
+		{"let [a,...b]=x; let {name,age:y}=u; let f=fn([p],{q}){p};", "let [a, ...b] = x;\nlet {name: name, age: y} = u;\nlet f = fn([p], {q: q}) { p };\n"},
+		{
+			`match(x){0=>"zero",[a,...b] if a>0=>{let c=a;c},{"k":v}=>({"v":v}),_=>{}}; -1`,
+			"match (x) {\n\t0 => \"zero\",\n\t[a, ...b] if a > 0 => {\n\t\tlet c = a;\n\t\tc\n\t},\n\t{\"k\": v} => ({\"v\": v}),\n\t_ => {},\n};\n-1;\n",
+		},
+		// single blank lines are kept
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = fn() {\n  a;\n\n  b\n};", "let a = 1;\n\nlet b = 2;\nlet c = fn() {\n\ta;\n\n\tb\n};\n"},
+		{"#!/usr/bin/env monkey\n\nprint(1)", "#!/usr/bin/env monkey\n\nprint(1);\n"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		res, err := Source([]byte(tc.input))
+		require.Nil(t, err, tc.input)
+		assert.Equal(t, tc.expected, string(res), tc.input)
+		checkFormatted(t, tc.input, res)
+	}
+}
+
+// checkFormatted checks the result parses to the same tree, and formatting it again changes nothing.
+func checkFormatted(t *testing.T, input string, res []byte) {
+	t.Helper()
+	assert.True(t, ast.Equal(parse(t, input), parse(t, string(res))), "tree changed: %s", res)
+	again, err := Source(res)
+	require.Nil(t, err, input)
+	assert.Equal(t, string(res), string(again), "not idempotent: %s", input)
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	require.Nil(t, p.Error(), input)
+	return program
+}
+
+func TestScripts(t *testing.T) {
+	files, err := filepath.Glob("../*.mk")
+	require.Nil(t, err)
+	require.NotEmpty(t, files)
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		require.Nil(t, err)
+		res, err := Source(src)
+		require.Nil(t, err, f)
+		checkFormatted(t, string(src), res)
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	_, err := Source([]byte("let = 1;"))
+	assert.NotNil(t, err)
+}
+
+func TestNode(t *testing.T) {
+	program := parse(t, "let f = fn(x) { x * 2 };\n\nf(1)")
+	// there is no source to tell where the blank lines are
+	assert.Equal(t, "let f = fn(x) { x * 2 };\nf(1);\n", Node(program))
+	assert.Equal(t, "let f = fn(x) { x * 2 };", Node(program.Statements[0]))
+	assert.Equal(t, "fn(x) { x * 2 }", Node(program.Statements[0].(*ast.LetStatement).Value))
+}
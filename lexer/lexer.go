@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"github.com/ChaosNyaruko/monkey/token"
 )
 
@@ -9,10 +11,19 @@ type Lexer struct {
 	position     int  // index of current char
 	ch           byte // the char being read (at position)
 	readPosition int  // index of the char after current char
+	line         int  // line of the current char
+	column       int  // column of the current char
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
+	// skip the shebang line, so that a script can be executed directly, e.g. #!/usr/bin/env monkey
+	if strings.HasPrefix(input, "#!") {
+		l.readPosition = strings.IndexByte(input, '\n')
+		if l.readPosition < 0 {
+			l.readPosition = len(input)
+		}
+	}
 	l.readChar()
 	return l
 }
@@ -54,6 +65,11 @@ func (l *Lexer) readIdentifier() string {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -75,6 +91,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWitespaces()
+	pos := token.Position{Line: l.line, Column: l.column}
 	switch l.ch {
 	case '"':
 		tok.Type = token.STRING
@@ -89,6 +106,10 @@ func (l *Lexer) NextToken() token.Token {
 				Type:    token.EQ,
 				Literal: literal,
 			}
+		} else if l.peekChar() == '>' {
+			// 0 => "zero"
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "=>"}
 		} else {
 			// 10 = 10
 			tok = newToken(token.ASSIGN, l.ch)
@@ -107,6 +128,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			// 10 != 9
@@ -143,10 +172,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -154,6 +185,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 	l.readChar()
 
+	tok.Pos = pos
 	return tok
 }
 
@@ -185,3 +185,90 @@ macro(x, y) { x + y };
 	}
 
 }
+
+func TestNextToken_Shebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+	}{
+		{"#!/usr/bin/env monkey\nlet x = 1;", []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF}},
+		{"#!/usr/bin/env monkey", []token.TokenType{token.EOF}},
+		{"x #! y", []token.TokenType{token.IDENT, token.ILLEGAL, token.BANG, token.IDENT, token.EOF}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Fatalf("%q: tokens[%d] - tokentype wrong. expected=%q, got=%q", tt.input, i, expected, tok.Type)
+			}
+		}
+	}
+}
+
+func TestNextToken_Position(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 10;\n\tx == \"a b\"\n"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Line: 2, Column: 1}},
+		{"x", token.Position{Line: 2, Column: 5}},
+		{"=", token.Position{Line: 2, Column: 7}},
+		{"10", token.Position{Line: 2, Column: 9}},
+		{";", token.Position{Line: 2, Column: 11}},
+		{"x", token.Position{Line: 3, Column: 2}},
+		{"==", token.Position{Line: 3, Column: 4}},
+		{"a b", token.Position{Line: 3, Column: 7}},
+		{"", token.Position{Line: 4, Column: 1}},
+	}
+
+	l := lexer.New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%v, got=%v", i, tok.Literal, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestNextToken_Ellipsis(t *testing.T) {
+	l := lexer.New("(a, ...b) .. x")
+	expected := []token.Token{
+		{Type: token.LPAREN, Literal: "("},
+		{Type: token.IDENT, Literal: "a"},
+		{Type: token.COMMA, Literal: ","},
+		{Type: token.ELLIPSIS, Literal: "..."},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.RPAREN, Literal: ")"},
+		{Type: token.ILLEGAL, Literal: "."},
+		{Type: token.ILLEGAL, Literal: "."},
+		{Type: token.IDENT, Literal: "x"},
+		{Type: token.EOF, Literal: ""},
+	}
+	for i, e := range expected {
+		tok := l.NextToken()
+		if tok.Type != e.Type || tok.Literal != e.Literal {
+			t.Fatalf("tokens[%d] wrong. expected=%v, got=%v", i, e, tok)
+		}
+	}
+}
+
+func TestNextToken_Arrow(t *testing.T) {
+	l := lexer.New("match (x) { 0 => a == b = c }")
+	expected := []token.TokenType{
+		token.MATCH, token.LPAREN, token.IDENT, token.RPAREN, token.LBRACE,
+		token.INT, token.ARROW, token.IDENT, token.EQ, token.IDENT, token.ASSIGN, token.IDENT,
+		token.RBRACE, token.EOF,
+	}
+	for i, e := range expected {
+		if tok := l.NextToken(); tok.Type != e {
+			t.Fatalf("tokens[%d] wrong. expected=%q, got=%q", i, e, tok.Type)
+		}
+	}
+}
@@ -1,17 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"os/user"
 
 	"github.com/ChaosNyaruko/monkey/eval"
-	"github.com/ChaosNyaruko/monkey/lexer"
-	"github.com/ChaosNyaruko/monkey/object"
-	"github.com/ChaosNyaruko/monkey/parser"
 	"github.com/ChaosNyaruko/monkey/repl"
 )
 
@@ -19,52 +15,58 @@ var (
 	interactive = flag.Bool("i", false, "run the interpreter in interactive mode")
 	filename    = flag.String("f", "", "the filename of source script to run")
 	help        = flag.Bool("h", false, "show this help doc")
+	ioRoots     = flag.String("io", "", "comma separated directories the script may read, enables the file and stdin builtins")
+	ioWrite     = flag.Bool("io-write", false, "allow the script to write files under the -io directories")
+	traceMacros = flag.Bool("trace-macros", false, "print every macro expansion step to stderr")
+	macroDepth  = flag.Int("max-macro-depth", eval.DefaultMaxDepth, "the maximum nesting depth of the macro expansions")
 )
 
 func main() {
+	// monkey <command> [arguments]
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	flag.Usage = usage
 	flag.Parse()
-	if *help || len(flag.Args()) > 0 {
-		flag.PrintDefaults()
+	if *help {
+		flag.Usage()
 		return
 	}
+	// monkey script.mk a b c, which is what a "#!/usr/bin/env monkey" script runs.
+	if *filename == "" && len(flag.Args()) > 0 {
+		os.Exit(runFile(flag.Arg(0), flag.Args()[1:], ioPolicy(*ioRoots, *ioWrite), expander(*traceMacros, *macroDepth)))
+	}
 	if *interactive || flag.NFlag() == 0 {
 		user, err := user.Current()
 		if err != nil {
 			panic(err)
 		}
 		fmt.Printf("Hello %s! This is the Monkey programming language!\nFeel to type in commands\n", user.Username)
-		repl.Start(os.Stdin, os.Stdout)
+		err = repl.Start(os.Stdin, os.Stdout)
+		var exit *eval.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
 		return
 	}
-	b, err := os.ReadFile(*filename)
-	if err != nil {
-		log.Fatalf("open file err: %v", err)
-	}
-	env := object.NewEnvironment(nil)
-	srcCode := string(b)
-	l := lexer.New(srcCode)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	if err = p.Error(); err != nil {
-		io.WriteString(os.Stderr, err.Error())
+	// only flags, e.g. monkey -trace-macros, there is nothing to run
+	if *filename == "" {
+		flag.Usage()
+		os.Exit(2)
 	}
+	// positional arguments are passed to the script: monkey -f script.mk -- a b c
+	os.Exit(runFile(*filename, flag.Args(), ioPolicy(*ioRoots, *ioWrite), expander(*traceMacros, *macroDepth)))
+}
 
-	// let reverse_sub = macro(a, b) {quote(unquote(b) - unquote(a))}
-	if err := eval.DefineMacros(program, env); err != nil {
-		fmt.Fprintf(os.Stderr, "define macros err: %v", err)
-	}
-
-	//  reverse_sub(1+2, 3+4) --> ((3+4)-(1+2))
-	eval.ExpandMacros(program, env)
-
-	// ((3+4)-(1+2)) -> 4
-	_, err = eval.Eval(program, env)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "eval err: %v\n", err)
-	}
-	// error in interpreter
-	if err != nil {
-		os.Exit(1)
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage:\n\n\tmonkey [flags] [script.mk [arguments]]\n\tmonkey <command> [arguments]\n\nThe commands are:\n\n")
+	for _, name := range commandNames {
+		fmt.Fprintf(out, "\t%-8s %s\n", name, commands[name].short)
 	}
-	return
+	fmt.Fprintf(out, "\nThe flags are:\n\n")
+	flag.PrintDefaults()
 }
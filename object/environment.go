@@ -1,10 +1,18 @@
 package object
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
 
 type Environment struct {
 	vars   map[string]Object
 	parent *Environment
+	// set by the host, see SetContext and SetOutput
+	ctx         context.Context
+	out, errOut io.Writer
 }
 
 func NewEnvironment(parent *Environment) *Environment {
@@ -29,3 +37,46 @@ func (e *Environment) Set(id string, obj Object) (Object, error) {
 	e.vars[id] = obj
 	return obj, nil
 }
+
+// SetContext sets the context of the evaluations in e and the environments enclosed by it,
+// the evaluations stop once it's canceled.
+func (e *Environment) SetContext(ctx context.Context) {
+	e.ctx = ctx
+}
+
+// Context returns the context set on e or the closest environment enclosing it, context.Background() if none.
+func (e *Environment) Context() context.Context {
+	for ; e != nil; e = e.parent {
+		if e.ctx != nil {
+			return e.ctx
+		}
+	}
+	return context.Background()
+}
+
+// SetOutput sets where the scripts evaluated in e and the environments enclosed by it write,
+// out for the normal output and errOut for the errors, e.g. print and eprint.
+// A nil writer is inherited from the enclosing environments.
+func (e *Environment) SetOutput(out, errOut io.Writer) {
+	e.out, e.errOut = out, errOut
+}
+
+// Output returns the writers set on e or the closest environments enclosing it, each one is looked up on its own,
+// os.Stdout and os.Stderr if none.
+func (e *Environment) Output() (out, errOut io.Writer) {
+	for ; e != nil && (out == nil || errOut == nil); e = e.parent {
+		if out == nil {
+			out = e.out
+		}
+		if errOut == nil {
+			errOut = e.errOut
+		}
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	if errOut == nil {
+		errOut = os.Stderr
+	}
+	return out, errOut
+}
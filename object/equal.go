@@ -0,0 +1,116 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Equal reports whether two objects are the same value, it is what `==` means in monkey.
+// Arrays and hashes are compared structurally, the order of hash pairs doesn't matter.
+// Objects without a value semantics, e.g. functions, are only equal to themselves.
+func Equal(a, b Object) bool {
+	if a.Type() == NULL_OBJ && b.Type() == NULL_OBJ {
+		return true
+	}
+	if h, ok := a.(Hashable); ok {
+		return h.Equals(b)
+	}
+	return a == b
+}
+
+// AsHashable returns o as a Hashable if it can be used as a hash key.
+// Arrays and hashes can only be keys if everything inside them is hashable.
+func AsHashable(o Object) (Hashable, bool) {
+	switch o := o.(type) {
+	case *Array:
+		for _, e := range o.Elements {
+			if _, ok := AsHashable(e); !ok {
+				return nil, false
+			}
+		}
+		return o, true
+	case *Hash:
+		for _, p := range o.order {
+			if _, ok := AsHashable(p.Value); !ok {
+				return nil, false
+			}
+		}
+		return o, true
+	case Hashable:
+		return o, true
+	}
+	return nil, false
+}
+
+func (i *Integer) Equals(o Object) bool {
+	other, ok := o.(*Integer)
+	return ok && i.Value == other.Value
+}
+
+func (b *Boolean) Equals(o Object) bool {
+	other, ok := o.(*Boolean)
+	return ok && b.Value == other.Value
+}
+
+func (s *String) Equals(o Object) bool {
+	other, ok := o.(*String)
+	return ok && s.Value == other.Value
+}
+
+func (a *Array) Equals(o Object) bool {
+	other, ok := o.(*Array)
+	if !ok || len(a.Elements) != len(other.Elements) {
+		return false
+	}
+	for i, e := range a.Elements {
+		if !Equal(e, other.Elements[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Hash) Equals(o Object) bool {
+	other, ok := o.(*Hash)
+	if !ok || h.Len() != other.Len() {
+		return false
+	}
+	for _, p := range h.order {
+		v, ok := other.Get(p.Key.(Hashable))
+		if !ok || !Equal(p.Value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// HashKey of an array combines the keys of its elements, it should only be called
+// on arrays accepted by AsHashable.
+func (a *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, e := range a.Elements {
+		k := e.(Hashable).HashKey()
+		h.Write([]byte(k.Type))
+		binary.LittleEndian.PutUint64(buf[:], k.Key)
+		h.Write(buf[:])
+	}
+	return HashKey{
+		Type: a.Type(),
+		Key:  h.Sum64(),
+	}
+}
+
+// HashKey of a hash doesn't depend on the order of the pairs, because the order is ignored by Equals.
+// It should only be called on hashes accepted by AsHashable.
+func (h *Hash) HashKey() HashKey {
+	var sum uint64
+	for _, p := range h.order {
+		k := (&Array{Elements: []Object{p.Key, p.Value}}).HashKey()
+		sum += k.Key
+	}
+	return HashKey{
+		Type: h.Type(),
+		Key:  sum,
+	}
+}
@@ -2,19 +2,25 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"slices"
 	"strings"
 
 	"github.com/ChaosNyaruko/monkey/ast"
+	"github.com/ChaosNyaruko/monkey/token"
 )
 
 type ObjectType string
 
+// Hashable objects can be used as keys of a Hash.
+// Equal objects must have the same HashKey, but objects with the same HashKey are not necessarily equal.
 type Hashable interface {
 	Object
 	HashKey() HashKey
-	// Equals(Object) bool TODO: deal with hash conflicts.
+	Equals(Object) bool
 }
 
 const (
@@ -33,6 +39,8 @@ const (
 var _ Hashable = &Integer{}
 var _ Hashable = &Boolean{}
 var _ Hashable = &String{}
+var _ Hashable = &Array{}
+var _ Hashable = &Hash{}
 
 var _ Object = &Integer{}
 var _ Object = &Boolean{}
@@ -114,7 +122,7 @@ func (b *Null) Type() ObjectType {
 }
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Parameters []ast.Expression // identifiers, array or hash patterns
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -166,11 +174,32 @@ func (s *String) Type() ObjectType {
 	return STRING_OBJ
 }
 
+// BuiltinFunction is a builtin which only needs its arguments, it's adapted by Simple.
 type BuiltinFunction func(args ...Object) (Object, error)
 
+// ContextFunction is a builtin which needs the interpreter, e.g. to call back a monkey function.
+type ContextFunction func(ctx *Context, args ...Object) (Object, error)
+
+// Context is what the interpreter passes to a builtin when it's called.
+type Context struct {
+	context.Context                                                 // canceled if the evaluation should stop
+	Out             io.Writer                                       // where the output of the script goes
+	ErrOut          io.Writer                                       // where the error output of the script goes
+	Env             *Environment                                    // the environment of the caller
+	Pos             token.Position                                  // the position of the call
+	Call            func(fn Object, args ...Object) (Object, error) // calls a function or a builtin
+}
+
+// Simple adapts a builtin which doesn't need the context.
+func Simple(fn BuiltinFunction) ContextFunction {
+	return func(_ *Context, args ...Object) (Object, error) {
+		return fn(args...)
+	}
+}
+
 type Builtin struct {
 	Name string
-	Fn   BuiltinFunction
+	Fn   ContextFunction
 }
 
 func (b *Builtin) Inspect() string {
@@ -211,16 +240,86 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash keeps its pairs in insertion order, the zero value is an empty hash.
 type Hash struct {
 	// no map[Object]Object -> {"key": "xx", "key": yy}
 	// no map[string]Object -> {2: "a", "2": "b"}
-	Pairs map[HashKey]HashPair
+	// different keys may have the same HashKey, they share a bucket and are told apart by Equals.
+	buckets map[HashKey][]*HashPair
+	order   []*HashPair // insertion order
+}
+
+func (h *Hash) lookup(key Hashable) *HashPair {
+	for _, p := range h.buckets[key.HashKey()] {
+		if key.Equals(p.Key) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	p := h.lookup(key)
+	if p == nil {
+		return nil, false
+	}
+	return p.Value, true
+}
+
+// Set adds or updates a pair, updating a pair doesn't change its position.
+func (h *Hash) Set(key Hashable, value Object) {
+	if p := h.lookup(key); p != nil {
+		p.Value = value
+		return
+	}
+	if h.buckets == nil {
+		h.buckets = make(map[HashKey][]*HashPair)
+	}
+	p := &HashPair{Key: key, Value: value}
+	hk := key.HashKey()
+	h.buckets[hk] = append(h.buckets[hk], p)
+	h.order = append(h.order, p)
+}
+
+func (h *Hash) Delete(key Hashable) bool {
+	p := h.lookup(key)
+	if p == nil {
+		return false
+	}
+	hk := key.HashKey()
+	isP := func(q *HashPair) bool { return q == p }
+	if h.buckets[hk] = slices.DeleteFunc(h.buckets[hk], isP); len(h.buckets[hk]) == 0 {
+		delete(h.buckets, hk)
+	}
+	h.order = slices.DeleteFunc(h.order, isP)
+	return true
+}
+
+func (h *Hash) Len() int {
+	return len(h.order)
+}
+
+// Pairs returns all the pairs in insertion order.
+func (h *Hash) Pairs() []HashPair {
+	res := make([]HashPair, 0, len(h.order))
+	for _, p := range h.order {
+		res = append(res, *p)
+	}
+	return res
+}
+
+func (h *Hash) Copy() *Hash {
+	c := &Hash{}
+	for _, p := range h.order {
+		c.Set(p.Key.(Hashable), p.Value)
+	}
+	return c
 }
 
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 	kvs := []string{}
-	for _, v := range h.Pairs {
+	for _, v := range h.Pairs() {
 		kvs = append(kvs, fmt.Sprintf("%s:%s", v.Key.Inspect(), v.Value.Inspect()))
 	}
 	out.WriteString("{")
@@ -247,6 +346,7 @@ func (a *Quote) Type() ObjectType {
 
 type Macro struct {
 	Parameters []*ast.Identifier
+	Rest       *ast.Identifier // the array of the rest arguments, nil if the macro is not variadic
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -258,6 +358,9 @@ func (m *Macro) Inspect() string {
 	for _, p := range m.Parameters {
 		params = append(params, p.String())
 	}
+	if m.Rest != nil {
+		params = append(params, "..."+m.Rest.String())
+	}
 
 	out.WriteString("macro")
 	out.WriteString("(")
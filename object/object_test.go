@@ -0,0 +1,142 @@
+package object
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collider is a key whose HashKey always collides with the other colliders.
+type collider struct {
+	String
+}
+
+func (c *collider) HashKey() HashKey {
+	return HashKey{Type: STRING_OBJ, Key: 42}
+}
+
+func (c *collider) Equals(o Object) bool {
+	other, ok := o.(*collider)
+	return ok && c.Value == other.Value
+}
+
+func TestHashCollision(t *testing.T) {
+	a := &collider{String{Value: "a"}}
+	b := &collider{String{Value: "b"}}
+	assert.Equal(t, a.HashKey(), b.HashKey())
+
+	h := &Hash{}
+	h.Set(a, &Integer{Value: 1})
+	h.Set(b, &Integer{Value: 2})
+	assert.Equal(t, 2, h.Len())
+
+	v, ok := h.Get(&collider{String{Value: "a"}})
+	assert.True(t, ok)
+	assert.Equal(t, "1", v.Inspect())
+	v, ok = h.Get(b)
+	assert.True(t, ok)
+	assert.Equal(t, "2", v.Inspect())
+	_, ok = h.Get(&collider{String{Value: "c"}})
+	assert.False(t, ok)
+
+	h.Set(a, &Integer{Value: 3})
+	assert.Equal(t, "{a:3,b:2}", h.Inspect())
+
+	assert.True(t, h.Delete(a))
+	assert.False(t, h.Delete(a))
+	v, ok = h.Get(b)
+	assert.True(t, ok)
+	assert.Equal(t, "2", v.Inspect())
+	assert.Equal(t, 1, h.Len())
+}
+
+func TestEqual(t *testing.T) {
+	arr := func(es ...Object) *Array { return &Array{Elements: es} }
+	hash := func(kvs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(kvs); i += 2 {
+			h.Set(kvs[i].(Hashable), kvs[i+1])
+		}
+		return h
+	}
+	one, two, s := &Integer{Value: 1}, &Integer{Value: 2}, &String{Value: "1"}
+	f := &Builtin{Name: "f"}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, two, false},
+		{one, s, false},
+		{&Null{}, &Null{}, true},
+		{&Null{}, one, false},
+		{arr(one, s), arr(&Integer{Value: 1}, &String{Value: "1"}), true},
+		{arr(one, s), arr(s, one), false},
+		{arr(one), arr(one, one), false},
+		{arr(arr(one)), arr(arr(one)), true},
+		{hash(s, one, one, two), hash(one, two, s, one), true},
+		{hash(s, one), hash(s, two), false},
+		{hash(s, one), hash(one, one), false},
+		{hash(arr(one), two), hash(arr(one), two), true},
+		{f, f, true},
+		{f, &Builtin{Name: "f"}, false},
+		{arr(f), arr(f), true},
+	}
+	for i, tc := range tests {
+		assert.Equal(t, tc.expected, Equal(tc.a, tc.b), "%d: %s == %s", i, tc.a.Inspect(), tc.b.Inspect())
+		if tc.expected {
+			ha, aok := AsHashable(tc.a)
+			hb, bok := AsHashable(tc.b)
+			if aok && bok {
+				assert.Equal(t, ha.HashKey(), hb.HashKey(), "%d: equal objects should have the same hash key", i)
+			}
+		}
+	}
+
+	_, ok := AsHashable(arr(one, f))
+	assert.False(t, ok)
+	_, ok = AsHashable(hash(one, f))
+	assert.False(t, ok)
+}
+
+func TestEnvironmentContext(t *testing.T) {
+	root := NewEnvironment(nil)
+	inner := NewEnvironment(NewEnvironment(root))
+	assert.Equal(t, context.Background(), inner.Context())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root.SetContext(ctx)
+	assert.Equal(t, ctx, inner.Context())
+	assert.Equal(t, context.Background(), NewEnvironment(nil).Context())
+}
+
+func TestEnvironmentOutput(t *testing.T) {
+	root := NewEnvironment(nil)
+	inner := NewEnvironment(root)
+	out, errOut := inner.Output()
+	assert.Equal(t, os.Stdout, out)
+	assert.Equal(t, os.Stderr, errOut)
+
+	var o, e bytes.Buffer
+	root.SetOutput(&o, &e)
+	out, errOut = inner.Output()
+	assert.Equal(t, &o, out)
+	assert.Equal(t, &e, errOut)
+
+	// a nil writer is inherited
+	var o2 bytes.Buffer
+	inner.SetOutput(&o2, nil)
+	out, errOut = inner.Output()
+	assert.Equal(t, &o2, out)
+	assert.Equal(t, &e, errOut)
+	other := NewEnvironment(nil)
+	other.SetOutput(nil, &e)
+	out, errOut = other.Output()
+	assert.Equal(t, os.Stdout, out)
+	assert.Equal(t, &e, errOut)
+}
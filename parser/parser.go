@@ -33,6 +33,9 @@ type Parser struct {
 
 	prefixFnMap map[token.TokenType]prefixFn
 	infixFnMap  map[token.TokenType]infixFn
+
+	// pattern is set while parsing a pattern, where {name} is short for {name: name}.
+	pattern bool
 }
 
 var precedences = map[token.TokenType]int{
@@ -71,6 +74,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixFnMap[token.STRING] = p.parseStringLiteral
 	p.prefixFnMap[token.LBRACKET] = p.parseArrayLiteral
 	p.prefixFnMap[token.LBRACE] = p.parseHashLiteral
+	p.prefixFnMap[token.MATCH] = p.parseMatchExpression
+	p.prefixFnMap[token.ELLIPSIS] = p.parseRestExpression
 	p.infixFnMap[token.PLUS] = p.parseInfixExpression
 	p.infixFnMap[token.MINUS] = p.parseInfixExpression
 	p.infixFnMap[token.ASTERISK] = p.parseInfixExpression
@@ -112,18 +117,34 @@ func (p *Parser) parseFunctionCall(f ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(lhs ast.Expression) ast.Expression {
-	// myArray[1+2]
+	// myArray[1+2], or a slice myArray[1:3], myArray[:-1], myArray[2:]
 	i := &ast.IndexExpression{
 		Token: p.curToken,
 		Left:  lhs,
 		Index: nil,
 	}
 	p.nextToken()
-	i.Index = p.parseExpression(LOWEST)
+	if !p.curTokenIs(token.COLON) {
+		i.Index = p.parseExpression(LOWEST)
+		if !p.peekTokenIs(token.COLON) {
+			if !p.expectPeek(token.RBRACKET) {
+				p.errors = append(p.errors, fmt.Sprintf("%s: the [ of the index is not closed", i.Token.Pos))
+				return nil
+			}
+			return i
+		}
+		p.nextToken() // ":"
+	}
+	s := &ast.SliceExpression{Token: i.Token, Left: lhs, Low: i.Index}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		s.High = p.parseExpression(LOWEST)
+	}
 	if !p.expectPeek(token.RBRACKET) {
-		panic("indexing[ is not closed")
+		p.errors = append(p.errors, fmt.Sprintf("%s: the [ of the slice is not closed", s.Token.Pos))
+		return nil
 	}
-	return i
+	return s
 }
 
 func (p *Parser) parseInfixExpression(lhs ast.Expression) ast.Expression {
@@ -148,11 +169,11 @@ func (p *Parser) parseInfixExpression(lhs ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIfElseExpression() ast.Expression {
+	res := &ast.IfExpression{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 	p.nextToken()
-	res := &ast.IfExpression{}
 	// parse condition
 	res.Condition = p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
@@ -386,15 +407,21 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Value: nil,
 	}
 
-	if !p.expectPeek(token.IDENT) {
+	switch {
+	case p.peekTokenIs(token.LBRACKET), p.peekTokenIs(token.LBRACE):
+		p.nextToken()
+		if stmt.Name = p.parsePattern(); stmt.Name == nil {
+			return nil
+		}
+	case p.expectPeek(token.IDENT):
+		stmt.Name = &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		}
+	default:
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
-	}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -422,7 +449,7 @@ type (
 	infixFn  func(lhs ast.Expression) ast.Expression // res = lhs + rhs
 )
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+func (p *Parser) parseFunctionParameters() []ast.Expression {
 	if p.peekTokenIs(token.RPAREN) {
 		// no params
 		p.nextToken()
@@ -430,37 +457,72 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	}
 
 	p.nextToken() // move to the first identifier
-	id := p.parseIdentifier().(*ast.Identifier)
-	ids := []*ast.Identifier{id}
+	params := []ast.Expression{p.parseParameter()}
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		id := p.parseIdentifier().(*ast.Identifier)
-		ids = append(ids, id)
+		params = append(params, p.parseParameter())
 	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return ids
+	return params
+}
+
+// parseParameter parses an identifier, ...rest, or an unquote_splice(...) which is replaced with a list of
+// identifiers in quote.
+func (p *Parser) parseParameter() ast.Expression {
+	if p.curTokenIs(token.IDENT) && p.curToken.Literal == "unquote_splice" && p.peekTokenIs(token.LPAREN) {
+		return p.parseExpression(LOWEST)
+	}
+	if p.curTokenIs(token.ELLIPSIS) {
+		rest, ok := p.parseRestExpression().(*ast.RestExpression)
+		if !ok {
+			return nil
+		}
+		if !p.peekTokenIs(token.RPAREN) {
+			p.errors = append(p.errors, fmt.Sprintf("the rest parameter %s should be the last one", rest))
+		}
+		return rest
+	}
+	if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+		return p.parsePattern()
+	}
+	return p.parseIdentifier()
+}
+
+// parsePattern parses a pattern of a let statement, a parameter or an arm of a match expression.
+func (p *Parser) parsePattern() ast.Expression {
+	pattern := p.pattern
+	p.pattern = true
+	defer func() { p.pattern = pattern }()
+	return p.parseExpression(LOWEST)
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	h := &ast.HashLiteral{
 		Token: p.curToken,
-		Pairs: make(map[ast.Expression]ast.Expression),
+		Pairs: []ast.HashPair{},
 	}
 	// parse key-value pairs
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken() // eat "{" or ","
 		key := p.parseExpression(LOWEST)
+		if id, ok := key.(*ast.Identifier); ok && p.pattern && (p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE)) {
+			h.Pairs = append(h.Pairs, ast.HashPair{Key: id, Value: &ast.Identifier{Token: id.Token, Value: id.Value}})
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+			continue
+		}
 		if !p.expectPeek(token.COLON) {
 			p.errors = append(p.errors, "no ':' after a key in hashmap")
 			return nil
 		}
 		p.nextToken() // eat ":"
 		if value := p.parseExpression(LOWEST); value != nil {
-			h.Pairs[key] = value
+			h.Pairs = append(h.Pairs, ast.HashPair{Key: key, Value: value})
 		} else {
 			p.errors = append(p.errors, fmt.Sprintf("parse value for '%q' error", key.String()))
 			return nil
@@ -538,7 +600,8 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 	f.Body = p.parseBlockStatement()
 
 	if !p.curTokenIs(token.RBRACE) {
-		panic("the { is not closed for macro")
+		p.errors = append(p.errors, fmt.Sprintf("%s: the { of the macro is not closed", f.Body.Token.Pos))
+		return nil
 	}
 
 	return f
@@ -562,8 +625,74 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	f.Body = p.parseBlockStatement()
 
 	if !p.curTokenIs(token.RBRACE) {
-		panic("the { is not closed")
+		p.errors = append(p.errors, fmt.Sprintf("%s: the { of the function is not closed", f.Body.Token.Pos))
+		return nil
 	}
 
 	return f
 }
+
+// parseRestExpression parses ...name, in the parameters of a macro or in a pattern.
+func (p *Parser) parseRestExpression() ast.Expression {
+	rest := &ast.RestExpression{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	rest.Name = p.parseIdentifier().(*ast.Identifier)
+	return rest
+}
+
+// parseMatchExpression parses
+//
+//	match (value) { pattern => expression, pattern if guard => { statements } }
+//
+// an arm is a block if it starts with "{", the comma after it is optional.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	res := &ast.MatchExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	res.Value = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+		arm := ast.MatchArm{Pattern: p.parsePattern()}
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		block := p.curTokenIs(token.LBRACE)
+		if block {
+			arm.Body = p.parseBlockStatement()
+		} else {
+			tok := p.curToken
+			arm.Body = &ast.BlockStatement{
+				Token:      tok,
+				Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: p.parseExpression(LOWEST)}},
+			}
+		}
+		res.Arms = append(res.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if !block && !p.peekTokenIs(token.RBRACE) {
+			p.errors = append(p.errors, fmt.Sprintf("expected , or } after a match arm, but got %s", p.peekToken.Type))
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return res
+}
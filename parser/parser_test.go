@@ -9,6 +9,7 @@ import (
 	"github.com/ChaosNyaruko/monkey/lexer"
 	"github.com/ChaosNyaruko/monkey/token"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPlayground(t *testing.T) {
@@ -48,6 +49,93 @@ macro(x, y) { x + y }
 	testInfixExpression(t, body.Statements[0].(*ast.ExpressionStatement).Expression, "x", "+", "y")
 }
 
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 0 => "zero", [a, ...b] if a > 0 => { a } [c] => c, _ => null, }`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p, input)
+	m, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	require.True(t, ok, "should be a match expression")
+	testExpression(t, m.Value, "x")
+	require.Equal(t, 4, len(m.Arms))
+
+	expected := []struct {
+		pattern, guard, body string
+	}{
+		{"0", "", "zero"},
+		{"[a,...b]", "(a>0)", "a"},
+		{"[c]", "", "c"},
+		{"_", "", "null"},
+	}
+	for i, e := range expected {
+		arm := m.Arms[i]
+		assert.Equal(t, e.pattern, arm.Pattern.String(), "arms[%d]", i)
+		if e.guard == "" {
+			assert.Nil(t, arm.Guard, "arms[%d]", i)
+		} else {
+			assert.Equal(t, e.guard, arm.Guard.String(), "arms[%d]", i)
+		}
+		assert.Equal(t, e.body, arm.Body.String(), "arms[%d]", i)
+	}
+
+	for input, expected := range map[string]string{
+		`match (x) { 0 => 1 1 => 2 }`: "expected , or } after a match arm, but got INT",
+		`match (x) { 0 : 1 }`:         "expected next token to be =>, but got :",
+		`match x { 0 => 1 }`:          "expected next token to be (, but got IDENT",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		assert.ErrorContains(t, p.Error(), expected, input)
+	}
+}
+
+func TestLetPattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = arr;`, "let [a,b,...rest] = arr;"},
+		{`let {name, age: years} = user;`, "let {name:name,age:years} = user;"},
+		{`let {user: {name}, "k": [x]} = h;`, "let {user:{name:name},k:[x]} = h;"},
+		{`let f = fn([x, y], {z}) { x };`, "let f = fn([x,y],{z:z})x;"},
+		{`match (x) { {name} => name }`, "match(x){{name:name}=>name}"},
+	}
+	for _, tc := range tests {
+		p := New(lexer.New(tc.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p, tc.input)
+		assert.Equal(t, tc.expected, program.String(), tc.input)
+	}
+
+	// the shorthand is only allowed in patterns
+	p := New(lexer.New(`let h = {name};`))
+	p.ParseProgram()
+	assert.ErrorContains(t, p.Error(), "no ':' after a key in hashmap")
+}
+
+func TestRestParameter(t *testing.T) {
+	input := `macro(head, ...body) { head }`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p, input)
+	m := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MacroLiteral)
+	require.Equal(t, 2, len(m.Parameters))
+	testExpression(t, m.Parameters[0], "head")
+	rest, ok := m.Parameters[1].(*ast.RestExpression)
+	require.True(t, ok, "should be a rest parameter, but got %T", m.Parameters[1])
+	assert.Equal(t, "body", rest.Name.Value)
+	assert.Equal(t, "...body", rest.String())
+
+	for input, expected := range map[string]string{
+		`macro(...a, b) { a }`: "the rest parameter ...a should be the last one",
+		`macro(...) { 1 }`:     "expected next token to be IDENT, but got )",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		assert.ErrorContains(t, p.Error(), expected, input)
+	}
+}
+
 func TestHashLiteral(t *testing.T) {
 	tests := []struct {
 		input string
@@ -70,8 +158,11 @@ func TestHashLiteral(t *testing.T) {
 			assert.Equal(t, 0, len(s.Pairs))
 			return
 		}
-		for k, v := range s.Pairs {
-			switch kv := k.(type) {
+		// pairs keep the source order
+		assert.Equal(t, "{foo:bar,2:true,2:false,true:TRUE}", s.String())
+		for _, pair := range s.Pairs {
+			v := pair.Value
+			switch kv := pair.Key.(type) {
 			case *ast.StringLiteral:
 				if kv.Value == "foo" {
 					assert.Equal(t, "bar", v.(*ast.StringLiteral).Value)
@@ -111,6 +202,37 @@ func TestIndexExpression(t *testing.T) {
 	}
 }
 
+func TestSliceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(slice a 1 3)"},
+		{"a[:-1]", "(slice a nil (- 1))"},
+		{"s[2:]", "(slice s 2 nil)"},
+		{"a[:]", "(slice a nil nil)"},
+		{"f(x)[i+1:len(a)][0]", "(index (slice (call f x) (+ i 1) (call len a)) 0)"},
+	}
+	for _, tc := range tests {
+		p := New(lexer.New(tc.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p, tc.input)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		assert.Equal(t, tc.expected, ast.SExpr(stmt.Expression), tc.input)
+	}
+
+	for input, expected := range map[string]string{
+		"a[1:":     "1:2: the [ of the slice is not closed",
+		"a[:":      "1:2: the [ of the slice is not closed",
+		"a[1":      "1:2: the [ of the index is not closed",
+		"[1,2][1:": "1:6: the [ of the slice is not closed",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		assert.ErrorContains(t, p.Error(), expected, input)
+	}
+}
+
 func TestArrayLiteral(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -227,8 +349,13 @@ func testLetStatement(t *testing.T, s ast.Statement, name string, value any) boo
 	}
 
 	// check left side
-	if letStmt.Name.Value != name {
-		t.Errorf("left name.Value should be %q, but got %q", name, letStmt.Name.Value)
+	id, ok := letStmt.Name.(*ast.Identifier)
+	if !ok {
+		t.Errorf("left side should be an Identifier, but got %T", letStmt.Name)
+		return false
+	}
+	if id.Value != name {
+		t.Errorf("left name.Value should be %q, but got %q", name, id.Value)
 		return false
 	}
 
@@ -642,6 +769,16 @@ func TestFunctionLiteral(t *testing.T) {
 		assert.Equal(t, 1, len(body.Statements))
 		testInfixExpression(t, body.Statements[0].(*ast.ExpressionStatement).Expression, "x", "+", "y")
 	}
+
+	for input, expected := range map[string]string{
+		"fn(x) { x":           "1:7: the { of the function is not closed",
+		"let f = fn() {\n 1;": "1:14: the { of the function is not closed",
+		"macro(x) { x":        "1:10: the { of the macro is not closed",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		assert.ErrorContains(t, p.Error(), expected, input)
+	}
 }
 
 func TestFunctionParameters(t *testing.T) {
@@ -655,6 +792,7 @@ func TestFunctionParameters(t *testing.T) {
 		{"fn(){}", nil},
 		{"fn(x){2 * x}", []string{"x"}},
 		{"fn(x,y,z){x+y*z;}", []string{"x", "y", "z"}},
+		{"fn(x, unquote_splice(ps)){x}", []string{"x", "unquote_splice(ps)"}},
 	} {
 
 		l := lexer.New(tc.input)
@@ -706,3 +844,23 @@ func TestCallFunction(t *testing.T) {
 		assert.Equal(t, tc.expected, exp.String())
 	}
 }
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `let add = fn(a, b) { return a + b; };
+let m = macro(x) { quote(unquote(x) * 2) };
+if (add(1, -2) < 3) { [1, "two", null][0] } else { {true: add}[true] };
+m(fn() { 1 }());`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p, input)
+
+	data, err := ast.MarshalJSON(program)
+	assert.Nil(t, err)
+	decoded, err := ast.UnmarshalJSON(data)
+	assert.Nil(t, err)
+	assert.True(t, ast.Equal(program, decoded))
+	// tokens and positions are kept too
+	again, err := ast.MarshalJSON(decoded)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(data), string(again))
+}
@@ -2,6 +2,7 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 
@@ -33,6 +34,10 @@ func Start(in io.Reader, out io.Writer) error {
 	fmt.Fprintf(out, MONKEY_FACE)
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment(nil)
+	// the output of the scripts goes to out too, e.g. print
+	env.SetOutput(out, out)
+	// the macros can be imported from the files in the working directory
+	expander := &eval.Expander{Import: eval.FileImporter(".")}
 	for {
 		fmt.Fprintf(out, PROMPT)
 		scanned := scanner.Scan()
@@ -56,15 +61,18 @@ func Start(in io.Reader, out io.Writer) error {
 			continue
 		}
 		// let reverse_sub = macro(a, b) {quote(unquote(b) - unquote(a))}
-		if err := eval.DefineMacros(program, env); err != nil {
-			fmt.Fprintf(out, "define macros err: %v", err)
-		}
-
 		//  reverse_sub(1+2, 3+4) --> ((3+4)-(1+2))
-		eval.ExpandMacros(program, env)
+		if _, err := expander.Expand(program, env); err != nil {
+			fmt.Fprintf(out, "expand macros err: %v\n", err)
+			continue
+		}
 		// evaluate: print the well-formed AST -> flag
 		// fmt.Fprintf(out, "%s\n", program.String())
 		ob, err := eval.Eval(program, env)
+		var exit *eval.ExitError
+		if errors.As(err, &exit) {
+			return exit
+		}
 		if err != nil {
 			fmt.Fprintf(out, "eval err: %v", err)
 			continue
@@ -0,0 +1,15 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartOutput(t *testing.T) {
+	var out strings.Builder
+	err := Start(strings.NewReader("print(1 + 2);\neprint(\"e\");\n1\n"), &out)
+	assert.ErrorContains(t, err, "EOF")
+	assert.Equal(t, MONKEY_FACE+PROMPT+"3\nnull\n"+PROMPT+"e\nnull\n"+PROMPT+"1\n"+PROMPT, out.String())
+}
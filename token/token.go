@@ -1,11 +1,28 @@
 // Package token provides the Lexer's tokenizer.
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Pos     Position  `json:"pos"` // where the token starts
+}
+
+// Position is a location in the source code, Line and Column start from 1, the zero value means unknown.
+// Column counts bytes.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -26,6 +43,8 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
+	ARROW     = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -37,6 +56,7 @@ const (
 	LET      = "let"
 	FUNCTION = "fn"
 	MACRO    = "macro"
+	MATCH    = "match"
 	IF       = "if"
 	ELSE     = "else"
 	RETURN   = "return"
@@ -54,6 +74,7 @@ const (
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"macro":  MACRO,
+	"match":  MATCH,
 	"let":    LET,
 	"if":     IF,
 	"else":   ELSE,